@@ -0,0 +1,277 @@
+package ncrlite
+
+import (
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// Estimated size of a set compressed with a certain codec.
+type Estimate struct {
+	Codec string // name of the codec
+	Bytes uint64 // estimated size in bytes
+}
+
+// Estimated sizes of a set compressed with different codecs.
+//
+// Only the "ncrlite" codec is implemented by this package. The others
+// are there for comparison.
+type Report struct {
+	Estimates []Estimate // sorted by size, smallest first
+}
+
+// Returns the codec with the smallest estimated size.
+func (r Report) Best() Estimate {
+	return r.Estimates[0]
+}
+
+// Estimates the size of set compressed with several codecs, without
+// compressing it:
+//
+//	ncrlite      as written by CompressSorted (exact)
+//	rice         Rice coding of the deltas with the optimal parameter
+//	elias-fano   Elias–Fano coding
+//	bitmap       a bitmap up to the largest value
+//	complement   ncrlite on the values below the largest that are not in set
+//	progression  start and step, only if set is an arithmetic progression
+//
+// Returns an error if set isn't sorted or has duplicates.
+func Analyze(set []uint64) (Report, error) {
+	r := Report{}
+	add := func(codec string, bits uint64) {
+		r.Estimates = append(r.Estimates, Estimate{codec, (bits + 7) / 8})
+	}
+
+	n := uint64(len(set))
+	sizeBits := 8 * uvarintLen(n)
+
+	if n <= 1 {
+		bits := sizeBits
+		if n == 1 {
+			bits += 8 * uvarintLen(set[0])
+		}
+		add("ncrlite", bits)
+		add("progression", bits)
+		return r, nil
+	}
+
+	ds, err := toDeltas(set, 0)
+	if err != nil {
+		return Report{}, err
+	}
+
+	add("ncrlite", sizeBits+deltaBits(ds, 0)+8)
+
+	_, riceBits := optimalRice(ds, 0)
+	add("rice", sizeBits+6+riceBits)
+
+	// The codecs below store the largest value instead of relying on
+	// deltas starting at zero.
+	maxBits := 8 * uvarintLen(set[n-1])
+
+	add("elias-fano", sizeBits+maxBits+eliasFanoBits(set))
+
+	// The bit for the largest value is implied.
+	add("bitmap", satAdd(maxBits, set[n-1]))
+
+	if m, first, ds, ones, ok := complementDeltas(set); ok {
+		bits := maxBits + 8*uvarintLen(m)
+		switch m {
+		case 0:
+		case 1:
+			bits += 8 * uvarintLen(first)
+		default:
+			bits += deltaBits(ds, ones) + 8
+		}
+		add("complement", bits)
+	}
+
+	progression := true
+	for i := 2; i < len(ds); i++ {
+		if ds[i] != ds[1] {
+			progression = false
+			break
+		}
+	}
+	if progression {
+		add("progression", sizeBits+8*(uvarintLen(set[0])+uvarintLen(ds[1])))
+	}
+
+	slices.SortStableFunc(r.Estimates, func(a, b Estimate) int {
+		if a.Bytes < b.Bytes {
+			return -1
+		} else if a.Bytes > b.Bytes {
+			return 1
+		}
+		return 0
+	})
+
+	return r, nil
+}
+
+// Returns the information-theoretic lower bound in bytes on the size of a
+// set of k values below n: lg (n choose k) bits, as there are that many
+// such sets. The -info flag of the ncrlite tool reports how far the
+// compressed set is from it.
+//
+// Uses Stirling's approximation, which is accurate to well within a byte
+// for large n and k. Assumes k ≤ n.
+func ShannonBound(n, k uint64) float64 {
+	return (lgfac(n) - lgfac(k) - lgfac(n-k)) / 8
+}
+
+// Approximates lg n! using Stirling's approximation.
+func lgfac(n uint64) float64 {
+	if n == 0 {
+		return 0
+	}
+	fn := float64(n)
+	return math.Log2(2*math.Pi*fn)/2 + fn*math.Log2(fn) - fn*math.Log2(math.E)
+}
+
+// Returns the number of bytes in the uvarint encoding of x.
+func uvarintLen(x uint64) uint64 {
+	ret := uint64(1)
+	for x >= 0x80 {
+		x >>= 7
+		ret++
+	}
+	return ret
+}
+
+// Returns the number of deltas of each bitlength.
+func bitLengthFreqs(ds []uint64) []int {
+	freq := []int{}
+	for _, d := range ds {
+		bn := bits.Len64(d) - 1
+		for bn >= len(freq) {
+			freq = append(freq, 0)
+		}
+		freq[bn]++
+	}
+	return freq
+}
+
+// Returns the exact number of bits CompressSorted uses for the codebook
+// and the deltas ds, plus another ones deltas that are one.
+func deltaBits(ds []uint64, ones uint64) uint64 {
+	freq := bitLengthFreqs(ds)
+	if ones > 0 {
+		if len(freq) == 0 {
+			freq = append(freq, 0)
+		}
+		freq[0] += int(ones)
+	}
+
+	// Rice coding is used, in a format variant, if smaller.
+	_, rice := optimalRice(ds, ones)
+	return min(huffmanBits(freq, 6), satAdd(rice, 12+6))
+}
+
+// Returns the exact number of bits used by the packed codebook and the
+// deltas, for deltas with the given bitlength frequencies.
+func huffmanBits(freq []int, width int) uint64 {
+	return buildHuffmanCode(freq).encodedBits(freq, width)
+}
+
+// Returns the exact number of bits used by the packed codebook and the
+// deltas encoded with it, for deltas with the given bitlength frequencies.
+func (h htCode) encodedBits(freq []int, width int) uint64 {
+	ret := h.packedBits(width)
+	for bn, entry := range h {
+		ret = satAdd(ret, satMul(uint64(freq[bn]), uint64(entry.length)+uint64(bn)))
+	}
+	return ret
+}
+
+// Returns the number of bits used to pack the codebook.
+func (h htCode) packedBits(width int) uint64 {
+	ret := uint64(headerBits(uint64(len(h)), h[0].length, width))
+	for i := 1; i < len(h); i++ {
+		diff := int(h[i].length) - int(h[i-1].length)
+		if diff < 0 {
+			diff = -diff
+		}
+		ret += uint64(2*diff + 1)
+	}
+	return ret
+}
+
+// Returns the number of bits of set when Elias–Fano coded.
+func eliasFanoBits(set []uint64) uint64 {
+	n := uint64(len(set))
+	universe := set[n-1] + 1
+	if universe == 0 { // overflow
+		universe = math.MaxUint64
+	}
+
+	l := uint64(0)
+	if universe/n > 1 {
+		l = uint64(bits.Len64(universe/n) - 1)
+	}
+
+	// The low l bits are stored verbatim and the high bits in unary.
+	return satAdd(n*l, n+(universe>>l))
+}
+
+// Returns the size and the smallest value of the complement of set below
+// its largest value, and its deltas: those that aren't one, and the number
+// of those that are. Returns false if the complement is too large.
+func complementDeltas(set []uint64) (uint64, uint64, []uint64, uint64, bool) {
+	n := uint64(len(set))
+	m := set[n-1] - (n - 1)
+	if m > math.MaxInt {
+		return 0, 0, nil, 0, false
+	}
+
+	ds := []uint64{}
+	ones := uint64(0)
+	add := func(d uint64) {
+		if d == 1 {
+			ones++
+		} else {
+			ds = append(ds, d)
+		}
+	}
+
+	first := uint64(0)
+	prev := uint64(0) // previous value in the complement
+	started := false
+	next := uint64(0) // next value that could be in the complement
+
+	for _, x := range set {
+		if x > next {
+			// The values next, ..., x-1 are in the complement.
+			if !started {
+				first = next
+				add(next + 1)
+				started = true
+			} else {
+				add(next - prev)
+			}
+			ones += x - next - 1
+			prev = x - 1
+		}
+		next = x + 1
+	}
+
+	return m, first, ds, ones, true
+}
+
+// Returns a+b, or 2⁶⁴-1 if that overflows.
+func satAdd(a, b uint64) uint64 {
+	ret, carry := bits.Add64(a, b, 0)
+	if carry != 0 {
+		return math.MaxUint64
+	}
+	return ret
+}
+
+// Returns a·b, or 2⁶⁴-1 if that overflows.
+func satMul(a, b uint64) uint64 {
+	hi, ret := bits.Mul64(a, b)
+	if hi != 0 {
+		return math.MaxUint64
+	}
+	return ret
+}
@@ -0,0 +1,128 @@
+package ncrlite
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"testing"
+)
+
+func estimate(r Report, codec string) (uint64, bool) {
+	for _, e := range r.Estimates {
+		if e.Codec == codec {
+			return e.Bytes, true
+		}
+	}
+	return 0, false
+}
+
+func TestAnalyzeExact(t *testing.T) {
+	for _, set := range [][]uint64{
+		{},
+		{12345},
+		{0xfffffffffffffffe, 0xffffffffffffffff},
+		{0, 1, 2, 3, 4, 5},
+		sample(1000000, 10000),
+		sample(20000, 10000),
+	} {
+		slices.Sort(set)
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, set)
+
+		r, err := Analyze(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, ok := estimate(r, "ncrlite")
+		if !ok || size != uint64(buf.Len()) {
+			t.Fatalf("%d ≠ %d", size, buf.Len())
+		}
+	}
+}
+
+func TestAnalyzeComplement(t *testing.T) {
+	set := []uint64{}
+	for i := uint64(0); i < 10000; i++ {
+		if i%1000 != 7 {
+			set = append(set, i)
+		}
+	}
+
+	r, err := Analyze(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Best().Codec != "complement" {
+		t.Fatalf("%v", r)
+	}
+
+	complement := []uint64{}
+	for i := uint64(0); i < 10000; i += 1000 {
+		complement = append(complement, i+7)
+	}
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, complement)
+
+	// Complement stores the largest value (2 bytes) and the complement.
+	size, _ := estimate(r, "complement")
+	if size != uint64(buf.Len())+2 {
+		t.Fatalf("%d ≠ %d+2", size, buf.Len())
+	}
+}
+
+func TestAnalyzeProgression(t *testing.T) {
+	set := []uint64{}
+	for i := uint64(0); i < 1000; i++ {
+		set = append(set, 1000000+7*i)
+	}
+	r, err := Analyze(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best := r.Best(); best.Codec != "progression" || best.Bytes != 6 {
+		t.Fatalf("%v", best)
+	}
+
+	set[500]++
+	r, err = Analyze(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := estimate(r, "progression"); ok {
+		t.Fatal()
+	}
+}
+
+func TestAnalyzeNotSet(t *testing.T) {
+	for _, set := range [][]uint64{
+		{1, 1},
+		{5, 3, 9},
+		{1, 2, 3, 3},
+	} {
+		if _, err := Analyze(set); err != errNotSet {
+			t.Fatalf("%v: %v", set, err)
+		}
+		if _, _, err := OptimalRiceParam(set); err != errNotSet {
+			t.Fatalf("%v: %v", set, err)
+		}
+	}
+}
+
+func TestShannonBound(t *testing.T) {
+	for _, tc := range []struct {
+		n, k uint64
+		want float64 // lg (n choose k) / 8, computed exactly
+	}{
+		{0, 0, 0},
+		{100, 0, 0},
+		{100, 100, 0},
+		{1000, 10, 9.7252},
+		{1 << 32, 1 << 20, 1761936.4237},
+		{735000000, 13000000, 11782908.0400}, // the WebPKI benchmark
+	} {
+		got := ShannonBound(tc.n, tc.k)
+		if math.Abs(got-tc.want) > 0.01 {
+			t.Fatalf("ShannonBound(%d, %d) = %f ≠ %f", tc.n, tc.k, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package ncrlite
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
+// Returns a compressed version of set encoded as (standard) base64.
+//
+// Assumes set is sorted and has no duplicates.
+func CompressSortedString(set []uint64) (string, error) {
+	buf := new(bytes.Buffer)
+	err := CompressSorted(buf, set)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Decompresses a set of uint64s from base64 as returned by
+// CompressSortedString.
+//
+// The returned slice will be sorted.
+func DecompressString(s string) ([]uint64, error) {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid base64: %w", err)
+	}
+	return Decompress(bytes.NewReader(buf))
+}
@@ -2,13 +2,22 @@ package ncrlite
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
+	"math/bits"
 )
 
-type bitReader struct {
-	r     *bufio.Reader
+// Reads a stream of bits, least significant bit of each byte first.
+//
+// Use it with NewDecompressorFromBits to read a compressed set embedded
+// in a larger bitstream.
+type BitReader struct {
+	r     io.Reader
+	data  []byte // if mem is set, the rest of the stream, instead of r
+	mem   bool
+	src   io.Reader // *bytes.Buffer or *bytes.Reader that data is from
 	buf   uint64
 	err   error
 	total int
@@ -17,41 +26,158 @@ type bitReader struct {
 	size    byte
 }
 
-type bitWriter struct {
-	w      *bufio.Writer
-	offset int
-	buf    uint64
-	err    error
+// Writes a stream of bits, least significant bit of each byte first.
+//
+// Use it with CompressSortedTo to embed a compressed set in a larger
+// bitstream.
+type BitWriter struct {
+	w       *bufio.Writer
+	offset  int
+	buf     uint64
+	err     error
+	flushed uint64 // bytes passed on to w
 }
 
-var errClosed = errors.New("bitWriter is closed")
+var errClosed = errors.New("BitWriter is closed")
 
-func newBitReader(r io.Reader) *bitReader {
-	return &bitReader{
+// Returned when a varint in the stream doesn't fit in 64 bits.
+var ErrUvarintOverflow = errors.New("Uvarint overflow")
+
+// Number of consecutive empty reads after which we give up with
+// io.ErrNoProgress, like bufio.Reader does.
+const maxEmptyReads = 100
+
+// Writer that counts the number of bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+
+	progress func(int64) // if set, called with n after each write
+}
+
+func (w *countingWriter) Write(buf []byte) (int, error) {
+	n, err := w.w.Write(buf)
+	w.n += int64(n)
+	if w.progress != nil {
+		w.progress(w.n)
+	}
+	return n, err
+}
+
+// Returns a BitReader for r.
+//
+// A *bytes.Buffer or *bytes.Reader is read from in place, which is faster
+// than going through a bufio.Reader. Like any other reader, it's advanced
+// only as far as the bits read, plus at most eight bytes buffered ahead.
+// As the BitReader holds on to the unread contents of a *bytes.Buffer,
+// don't write to the buffer until done reading.
+func NewBitReader(r io.Reader) *BitReader {
+	switch r := r.(type) {
+	case *bytes.Buffer:
+		br := newSliceBitReader(r.Bytes())
+		br.src = r
+		return br
+	case *bytes.Reader:
+		var c captureWriter
+		pos, _ := r.Seek(0, io.SeekCurrent)
+		r.WriteTo(&c)
+		r.Seek(pos, io.SeekStart)
+		br := newSliceBitReader(c.data)
+		br.src = r
+		return br
+	}
+
+	return &BitReader{
 		r: bufio.NewReader(r),
 	}
 }
 
-func newBitWriter(w io.Writer) *bitWriter {
-	return &bitWriter{
+// Writer that remembers what it's given, so that we can get at the unread
+// contents of a bytes.Reader without copying: its WriteTo passes them in
+// a single Write. They're never changed, so it's safe to hold on to them.
+type captureWriter struct {
+	data []byte
+}
+
+func (w *captureWriter) Write(buf []byte) (int, error) {
+	w.data = buf
+	return len(buf), nil
+}
+
+// Advances src past the n bytes of data just consumed.
+func (r *BitReader) advance(n int) {
+	switch src := r.src.(type) {
+	case *bytes.Buffer:
+		src.Next(n)
+	case *bytes.Reader:
+		src.Seek(int64(n), io.SeekCurrent)
+	}
+}
+
+// Returns a BitReader that reads from data.
+func newSliceBitReader(data []byte) *BitReader {
+	return &BitReader{
+		data: data,
+		mem:  true,
+	}
+}
+
+// Reads the next bytes of the stream into buf.
+//
+// Short reads without an error, which a bufio.Reader over a net.Conn may
+// return, are retried. Only when nothing is read do we return an error,
+// which is io.EOF at the end of the stream, but might also be a timeout.
+func (r *BitReader) read(buf []byte) (int, error) {
+	if !r.mem {
+		for i := 0; i < maxEmptyReads; i++ {
+			n, err := r.r.Read(buf)
+			if n > 0 || err != nil {
+				return n, err
+			}
+		}
+		return 0, io.ErrNoProgress
+	}
+
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(buf, r.data)
+	r.data = r.data[n:]
+	r.advance(n)
+	return n, nil
+}
+
+// Returns a BitWriter that writes to w. Call Close to flush it.
+func NewBitWriter(w io.Writer) *BitWriter {
+	return &BitWriter{
 		w: bufio.NewWriter(w),
 	}
 }
 
-func (w *bitWriter) Err() error {
+// Returns the first error writing to the underlying writer, if any.
+func (w *BitWriter) Err() error {
 	return w.err
 }
 
-func (r *bitReader) Err() error {
+// Returns the first error reading, if any, which is io.EOF when reading
+// beyond the end of the stream.
+func (r *BitReader) Err() error {
 	return r.err
 }
 
 // Returns offset in current byte
-func (w *bitWriter) BitOffset() byte {
+func (w *BitWriter) BitOffset() byte {
 	return byte(w.offset)
 }
 
-func (w *bitWriter) Close() error {
+// Returns the number of bits written so far.
+func (w *BitWriter) bitsWritten() uint64 {
+	return 8*w.flushed + uint64(w.offset)
+}
+
+// Writes out the bits, padding the last byte with zeroes, and flushes.
+func (w *BitWriter) Close() error {
 	if w.err != nil {
 		return w.err
 	}
@@ -73,7 +199,9 @@ func (w *bitWriter) Close() error {
 	return nil
 }
 
-func (w *bitWriter) WriteBits(bs uint64, l int) {
+// Writes the l least significant bits of bs. Assumes l ≤ 64 and that
+// the other bits of bs are zero.
+func (w *BitWriter) WriteBits(bs uint64, l int) {
 	if w.err != nil {
 		return
 	}
@@ -92,6 +220,7 @@ func (w *bitWriter) WriteBits(bs uint64, l int) {
 		w.err = err
 		return
 	}
+	w.flushed += 8
 
 	l2 := 64 - w.offset
 	w.buf = bs >> l2
@@ -99,15 +228,30 @@ func (w *bitWriter) WriteBits(bs uint64, l int) {
 }
 
 // Reads bits assuming l <= r.size.
-func (r *bitReader) readBits(l byte) uint64 {
+func (r *BitReader) readBits(l byte) uint64 {
 	ret := r.buf & (uint64(1<<l) - 1)
 	r.size -= l
 	r.buf >>= l
 	return ret
 }
 
-func (r *bitReader) fill() bool {
-	n, err := r.r.Read(r.scratch[:])
+func (r *BitReader) fill() bool {
+	// Once we missed bits, the position in the stream is lost, so we
+	// don't resume even if the underlying reader does.
+	if r.err != nil {
+		return false
+	}
+
+	if len(r.data) >= 8 {
+		r.buf = binary.LittleEndian.Uint64(r.data)
+		r.data = r.data[8:]
+		r.advance(8)
+		r.total += 8
+		r.size = 64
+		return true
+	}
+
+	n, err := r.read(r.scratch[:])
 	if n == 0 {
 		r.err = err
 		return false
@@ -126,7 +270,8 @@ func (r *bitReader) fill() bool {
 	return true
 }
 
-func (r *bitReader) ReadBit() byte {
+// Reads a single bit.
+func (r *BitReader) ReadBit() byte {
 	if r.size == 0 {
 		if !r.fill() {
 			return 0
@@ -140,13 +285,27 @@ func (r *bitReader) ReadBit() byte {
 	return ret
 }
 
-// Return the next byte that will be read.
-func (r *bitReader) PeekByte() byte {
-	for 8 > r.size {
-		n, err := r.r.Read(r.scratch[:4])
+// Return the next byte that will be read. If there are fewer than eight
+// bits left before EOF, the missing bits are zero.
+func (r *BitReader) PeekByte() byte {
+	for 8 > r.size && r.err == nil {
+		if len(r.data) >= 4 {
+			r.buf |= uint64(binary.LittleEndian.Uint32(r.data)) << r.size
+			r.data = r.data[4:]
+			r.advance(4)
+			r.total += 4
+			r.size += 32
+			continue
+		}
+
+		n, err := r.read(r.scratch[:4])
 		if n == 0 {
-			r.err = err
-			return 0
+			// Don't flag EOF yet: the caller might not need the missing
+			// bits. If it does, it'll hit EOF when trying to read them.
+			if err != io.EOF {
+				r.err = err
+			}
+			return byte(r.buf)
 		}
 
 		r.total += n
@@ -164,43 +323,84 @@ func (r *bitReader) PeekByte() byte {
 	return byte(r.buf)
 }
 
+// Returns whether fewer than eight bits are left before EOF. Returns
+// false on other errors.
+func (r *BitReader) NearEOF() bool {
+	r.PeekByte()
+	return r.size < 8 && r.err == nil
+}
+
 // Read l bits from r. Assumes l ≤ 64.
-func (r *bitReader) ReadBits(l byte) uint64 {
+func (r *BitReader) ReadBits(l byte) uint64 {
 	read := min(l, r.size)
 
 	ret := r.readBits(read)
-	if read == l {
-		return ret
-	}
 
-	if !r.fill() {
-		return 0
+	// A fill might return fewer bits than we need, for instance at the
+	// end of the buffer of the underlying bufio.Reader.
+	for read < l {
+		if !r.fill() {
+			return 0
+		}
+
+		n := min(l-read, r.size)
+		ret |= r.readBits(n) << read
+		read += n
 	}
 
-	ret |= r.readBits(l-read) << read
 	return ret
 }
 
-// Read l bits from r, but do not return them.
-func (r *bitReader) SkipBits(l byte) {
-	read := min(l, r.size)
+// Reads zero bits up to and including the next one bit, and returns the
+// number of zero bits, scanning a word at a time. Gives up once more than
+// max zero bits are read, returning their number so far.
+func (r *BitReader) ReadUnary(max uint64) uint64 {
+	var ret uint64
+
+	// The bits in buf beyond size are always zero, so a non-zero buf
+	// has a one bit within the first size bits.
+	for {
+		if r.buf != 0 {
+			tz := byte(bits.TrailingZeros64(r.buf))
+			r.buf >>= tz
+			r.buf >>= 1
+			r.size -= tz + 1
+			return ret + uint64(tz)
+		}
 
-	if read != r.size {
+		ret += uint64(r.size)
+		r.size = 0
+
+		if ret > max || !r.fill() {
+			return ret
+		}
+	}
+}
+
+// Read l bits from r, but do not return them.
+func (r *BitReader) SkipBits(l byte) {
+	if l <= r.size {
 		r.size -= l
 		r.buf >>= l
 		return
 	}
 
-	if !r.fill() {
-		return
-	}
+	rest := l - r.size
 
-	rest := l - read
-	r.size -= rest
-	r.buf >>= rest
+	for rest > 0 {
+		if !r.fill() {
+			return
+		}
+
+		n := min(rest, r.size)
+		r.size -= n
+		r.buf >>= n
+		rest -= n
+	}
 }
 
-func (w *bitWriter) WriteUvarint(x uint64) {
+// Writes x as unsigned varint, in eight bits per seven bits of x.
+func (w *BitWriter) WriteUvarint(x uint64) {
 	for x >= 0x80 {
 		w.WriteBits(uint64(byte(x)|0x80), 8)
 		x >>= 7
@@ -209,19 +409,23 @@ func (w *bitWriter) WriteUvarint(x uint64) {
 	w.WriteBits(uint64(byte(x)), 8)
 }
 
-func (r *bitReader) ReadUvarint() uint64 {
+// Reads an unsigned varint. Sets the error to ErrUvarintOverflow if it
+// doesn't fit in 64 bits.
+func (r *BitReader) ReadUvarint() uint64 {
 	var ret uint64
 
 	for s := 0; s <= 63; s += 7 {
 		x := r.ReadBits(7)
-		if s == 63 && x > 1 {
-			if r.err != nil {
-				r.err = errors.New("Uvarint overflow")
+		more := r.ReadBits(1)
+
+		if s == 63 && (x > 1 || more == 1) {
+			if r.err == nil {
+				r.err = ErrUvarintOverflow
 			}
 			return 0
 		}
+
 		ret |= x << s
-		more := r.ReadBits(1)
 
 		if more == 0 {
 			break
@@ -2,13 +2,19 @@ package ncrlite
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"slices"
 	"testing"
 )
 
 func TestUvarint(t *testing.T) {
 	buf := new(bytes.Buffer)
 
-	w := newBitWriter(buf)
+	w := NewBitWriter(buf)
 	for i := uint64(0); i < 1000; i++ {
 		w.WriteUvarint(i)
 	}
@@ -17,7 +23,7 @@ func TestUvarint(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	r := newBitReader(buf)
+	r := NewBitReader(buf)
 	for i := uint64(0); i < 1000; i++ {
 		j := r.ReadUvarint()
 		if i != j {
@@ -29,3 +35,293 @@ func TestUvarint(t *testing.T) {
 		}
 	}
 }
+
+func TestUvarintOverflow(t *testing.T) {
+	for _, xs := range [][]byte{
+		// 2⁶⁴ (one too large)
+		{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02},
+		// Too many continuation bytes
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x81, 0x00},
+	} {
+		r := NewBitReader(bytes.NewReader(xs))
+		r.ReadUvarint()
+		if r.Err() != ErrUvarintOverflow {
+			t.Fatalf("%x: %v", xs, r.Err())
+		}
+	}
+
+	xs := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	r := NewBitReader(bytes.NewReader(xs))
+	x := r.ReadUvarint()
+	if r.Err() != nil || x != 0xffffffffffffffff {
+		t.Fatalf("%x %v", x, r.Err())
+	}
+}
+
+// Reader that returns at most three bytes at a time.
+type trickleReader struct {
+	r io.Reader
+}
+
+func (r *trickleReader) Read(buf []byte) (int, error) {
+	return r.r.Read(buf[:min(len(buf), 3)])
+}
+
+func TestReadBitsShortReads(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewBitWriter(buf)
+	for i := 0; i < 1000; i++ {
+		w.WriteBits(uint64(i)<<50|uint64(i), 63)
+		w.WriteBits(uint64(i%2), 1)
+	}
+	w.Close()
+
+	r := NewBitReader(&trickleReader{buf})
+	for i := 0; i < 1000; i++ {
+		x := r.ReadBits(63)
+		if x != uint64(i)<<50|uint64(i) {
+			t.Fatalf("%d: %x", i, x)
+		}
+		r.SkipBits(1)
+	}
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+}
+
+// Hides the type of the underlying reader, so that the BitReader
+// can't read from memory directly.
+type plainReader struct {
+	r io.Reader
+}
+
+func (r *plainReader) Read(buf []byte) (int, error) {
+	return r.r.Read(buf)
+}
+
+func TestSliceBitReader(t *testing.T) {
+	for _, k := range []int{0, 1, 2, 3, 100, 1000} {
+		set := sample(100000, k)
+		var buf bytes.Buffer
+		Compress(&buf, set)
+		xs := buf.Bytes()
+
+		// Also try truncated streams, which should fail the same way.
+		for _, l := range []int{len(xs), len(xs) - 1, len(xs) / 2, 3, 0} {
+			if l < 0 {
+				continue
+			}
+
+			want, wantErr := Decompress(&plainReader{bytes.NewReader(xs[:l])})
+			got, gotErr := Decompress(bytes.NewReader(xs[:l]))
+			got2, gotErr2 := Decompress(bytes.NewBuffer(xs[:l]))
+
+			if fmt.Sprint(wantErr) != fmt.Sprint(gotErr) ||
+				fmt.Sprint(wantErr) != fmt.Sprint(gotErr2) {
+				t.Fatalf("%d %d: %v %v %v", k, l, wantErr, gotErr, gotErr2)
+			}
+			if !slices.Equal(want, got) || !slices.Equal(want, got2) {
+				t.Fatalf("%d %d: %v %v %v", k, l, want, got, got2)
+			}
+		}
+	}
+}
+
+// A bytes.Buffer or bytes.Reader is read in place, and advanced about as
+// far as the set, so that what follows it can still be read.
+func TestBitReaderInPlace(t *testing.T) {
+	set := sample(100000, 1000)
+	var buf bytes.Buffer
+	Compress(&buf, set)
+	xs := buf.Bytes()
+	trailer := make([]byte, 100)
+
+	// Start the bytes.Reader beyond some junk to check we read from its
+	// position, and not from the start.
+	r := bytes.NewReader(slices.Concat(trailer, xs, trailer))
+	r.Seek(int64(len(trailer)), io.SeekStart)
+
+	for _, src := range []interface {
+		io.Reader
+		Len() int
+	}{
+		bytes.NewBuffer(slices.Concat(xs, trailer)),
+		r,
+	} {
+		if !NewBitReader(src).mem {
+			t.Fatal("not read in place")
+		}
+
+		got, err := Decompress(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatal()
+		}
+		if src.Len() < len(trailer)-8 || src.Len() > len(trailer) {
+			t.Fatal(src.Len())
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Reader that behaves like a slow net.Conn: every other read returns
+// nothing, and every timeoutEvery-th read times out.
+type flakyReader struct {
+	r            io.Reader
+	n            int
+	timeoutEvery int
+}
+
+func (r *flakyReader) Read(buf []byte) (int, error) {
+	r.n++
+	if r.n%2 == 0 {
+		return 0, nil
+	}
+	if r.timeoutEvery != 0 && r.n%r.timeoutEvery == 0 {
+		return 0, timeoutError{}
+	}
+	return r.r.Read(buf[:min(len(buf), 3)])
+}
+
+func TestFlakyReader(t *testing.T) {
+	set := sample(100000, 1000)
+	var buf bytes.Buffer
+	Compress(&buf, set)
+	xs := buf.Bytes()
+
+	got, err := Decompress(&flakyReader{r: bytes.NewReader(xs)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(set, got) {
+		t.Fatalf("%v %v", set, got)
+	}
+
+	d, err := NewDecompressor(&flakyReader{r: bytes.NewReader(xs), timeoutEvery: 51})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = make([]uint64, len(set))
+	err = d.Read(got)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	// We lost our position in the stream, so we shouldn't continue
+	// decoding even though the reader resumes.
+	if err := d.Read(got); !errors.As(err, &netErr) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestCompressSortedTo(t *testing.T) {
+	sets := [][]uint64{{}, {7}, {1, 2, 3}, sample(100000, 1000)}
+	for _, set := range sets {
+		slices.Sort(set)
+	}
+
+	// Sets at odd bit offsets, separated by a few bits.
+	buf := new(bytes.Buffer)
+	w := NewBitWriter(buf)
+	for _, set := range sets {
+		w.WriteBits(5, 3)
+		if err := CompressSortedTo(w, set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.WriteBits(5, 3)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewBitReader(buf)
+	for _, set := range sets {
+		if x := r.ReadBits(3); x != 5 {
+			t.Fatalf("%d", x)
+		}
+		d, err := NewDecompressorFromBits(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]uint64, d.Remaining())
+		if err := d.Read(got); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("%v %v", got, set)
+		}
+	}
+	if x := r.ReadBits(3); x != 5 || r.Err() != nil {
+		t.Fatalf("%d %v", x, r.Err())
+	}
+}
+
+func TestEndMarkerStraddlesBuffer(t *testing.T) {
+	sets := [][]uint64{
+		{1, 2, 3, 100},        // Huffman code
+		sample(100000, 1000),  // Rice code
+		{0, 1, 2, 4, 5, 6, 9}, // two bitlengths
+	}
+
+	straddled := 0
+	for _, set := range sets {
+		slices.Sort(set)
+
+		// The endmarker ends with a one bit, which is the last one in
+		// the stream: that tells where it is.
+		var plain bytes.Buffer
+		CompressSorted(&plain, set)
+		xs := plain.Bytes()
+		end := 8*(len(xs)-1) + bits.Len8(xs[len(xs)-1])
+
+		// Shift the set by every offset, so that the endmarker straddles
+		// the 64-bit buffer of the BitReader for some of them.
+		for offset := 0; offset < 64; offset++ {
+			if (offset+end-8)/64 != (offset+end-1)/64 {
+				straddled++
+			}
+
+			buf := new(bytes.Buffer)
+			w := NewBitWriter(buf)
+			w.WriteBits(0, offset)
+			if err := CompressSortedTo(w, set); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, r := range []io.Reader{
+				bytes.NewReader(buf.Bytes()),
+				&plainReader{bytes.NewReader(buf.Bytes())},
+				&trickleReader{bytes.NewReader(buf.Bytes())},
+			} {
+				br := NewBitReader(r)
+				br.SkipBits(byte(offset))
+				d, err := NewDecompressorFromBits(br)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]uint64, d.Remaining())
+				if err := d.Read(got); err != nil {
+					t.Fatalf("offset %d: %v", offset, err)
+				}
+				if !slices.Equal(got, set) {
+					t.Fatalf("offset %d: %v %v", offset, got, set)
+				}
+			}
+		}
+	}
+
+	if straddled == 0 {
+		t.Fatal("endmarker never straddles a buffer")
+	}
+}
@@ -0,0 +1,46 @@
+package ncrlite
+
+import "errors"
+
+var errBitmapBounds = errors.New("Value outside of bitmap")
+
+// Decompresses the remaining values, and sets the bit at position
+// value-base in bm for each, where bit i is bit i%64 of bm[i/64].
+// Doesn't clear the other bits.
+//
+// Returns an error if a value is below base or beyond the bitmap. The
+// values before it are set by then.
+func (d *Decompressor) ReadBitmap(bm []uint64, base uint64) error {
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+
+	for d.remaining > 0 {
+		xs := buf[:min(uint64(len(buf)), d.remaining)]
+		if err := d.Read(xs); err != nil {
+			return err
+		}
+
+		if err := setBits(bm, base, xs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sets the bit at position x-base in bm for each x in xs, as ReadBitmap
+// does. Returns errBitmapBounds at the first value outside of bm.
+func setBits(bm []uint64, base uint64, xs []uint64) error {
+	for _, x := range xs {
+		i := x - base
+		if x < base || i/64 >= uint64(len(bm)) {
+			return errBitmapBounds
+		}
+		bm[i/64] |= 1 << (i % 64)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestReadBitmap(t *testing.T) {
+	set := sample(100000, 5000)
+	slices.Sort(set)
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+	xs := buf.Bytes()
+
+	for _, base := range []uint64{0, set[0]} {
+		d, err := NewDecompressor(bytes.NewReader(xs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bm := make([]uint64, (100000-base+63)/64)
+		if err := d.ReadBitmap(bm, base); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []uint64
+		for i := uint64(0); i < 64*uint64(len(bm)); i++ {
+			if bm[i/64]&(1<<(i%64)) != 0 {
+				got = append(got, i+base)
+			}
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("%d: %v %v", base, got, set)
+		}
+	}
+
+	// Out of bounds on either side.
+	for _, tc := range []struct {
+		base  uint64
+		words int
+	}{
+		{set[0] + 1, 100000 / 64},
+		{set[0], int(set[len(set)-1]-set[0]) / 64},
+	} {
+		d, err := NewDecompressor(bytes.NewReader(xs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bm := make([]uint64, tc.words)
+		if err := d.ReadBitmap(bm, tc.base); err != errBitmapBounds {
+			t.Fatalf("%v: %v", tc, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package ncrlite
+
+import "context"
+
+// Returns a channel on which the remaining values are sent, each as soon
+// as it's decoded. The channel has a buffer of bufSize values.
+//
+// The channel is closed when all values are sent, when decompression
+// fails, or when ctx is done, in which case the decoding goroutine stops.
+// Afterwards, Err returns why it stopped early, if it did.
+//
+// d must not be used otherwise until the channel is closed.
+func (d *Decompressor) Channel(ctx context.Context, bufSize int) <-chan uint64 {
+	ch := make(chan uint64, bufSize)
+
+	go func() {
+		defer close(ch)
+
+		if err := d.readHeader(); err != nil {
+			d.err = err
+			return
+		}
+
+		var buf [1]uint64
+		for d.remaining > 0 {
+			if err := ctx.Err(); err != nil {
+				d.err = err
+				return
+			}
+
+			if err := d.Read(buf[:]); err != nil {
+				d.err = err
+				return
+			}
+
+			select {
+			case ch <- buf[0]:
+			case <-ctx.Done():
+				d.err = ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Returns the error that closed the channel returned by Channel early,
+// if any. Only call after the channel is closed.
+func (d *Decompressor) Err() error {
+	return d.err
+}
@@ -0,0 +1,61 @@
+package ncrlite
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestChannel(t *testing.T) {
+	set := sample(100000, 1000)
+	slices.Sort(set)
+
+	var buf bytes.Buffer
+	CompressSorted(&buf, set)
+	xs := buf.Bytes()
+
+	d, err := NewDecompressor(bytes.NewReader(xs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := []uint64{}
+	for x := range d.Channel(context.Background(), 16) {
+		ret = append(ret, x)
+	}
+	if d.Err() != nil {
+		t.Fatal(d.Err())
+	}
+	if !slices.Equal(set, ret) {
+		t.Fatalf("%v %v", set, ret)
+	}
+
+	// Stop reading halfway.
+	d, err = NewDecompressor(bytes.NewReader(xs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := d.Channel(ctx, 0)
+	for i := 0; i < 500; i++ {
+		<-ch
+	}
+	cancel()
+	for range ch {
+	}
+	if d.Err() != context.Canceled {
+		t.Fatal(d.Err())
+	}
+
+	// Truncated stream
+	d, err = NewDecompressor(bytes.NewReader(xs[:len(xs)/2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range d.Channel(context.Background(), 16) {
+	}
+	if d.Err() == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -8,12 +8,15 @@ import (
 	"golang.org/x/term"
 
 	"bufio"
+	"bytes"
+	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"math"
+	"math/bits"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -23,9 +26,18 @@ var (
 
 	decompress = flag.Bool("decompress", false, "specify to decompress")
 	info       = flag.Bool("info", false, "specify to print info on compressed file")
+	headerOnly = flag.Bool("header-only", false, "with -info, only read the header; implies -info")
+	analyze    = flag.Bool("analyze", false, "print estimated compressed sizes for several codecs")
+	armor      = flag.Bool("armor", false, "base64 encode compressed file")
+	count      = flag.Bool("count", false, "print number of values in compressed file")
 	keep       = flag.Bool("keep", false, "keep (don't delete) input file")
 	toStdout   = flag.Bool("stdout", false, "write to stdout; implies -k")
 	force      = flag.Bool("force", false, "overwrite output")
+	concat     = flag.Bool("concat", false, "concatenate compressed files with consecutive ranges of values")
+	merge      = flag.Bool("merge", false, "with -concat, allow the ranges to overlap")
+	output     = flag.String("output", "", "with -concat, write to this file instead of stdout")
+	keepGoing  = flag.Bool("keep-going", false, "with several files, continue with the next file after a failure")
+	ordered    = flag.Bool("ordered", false, "keep the order of the values, which may repeat")
 
 	// State
 	inPath  string
@@ -34,20 +46,91 @@ var (
 	outFile *os.File
 )
 
-// Approximates lg n! using Stirling's approximation
-func lgfac(n uint64) float64 {
-	fn := float64(n)
-	return math.Log2(2*math.Pi*fn)/2 + fn*math.Log2(fn) - fn*math.Log2(math.E)
+const extension = ".ncrlite"
+
+// Keeps track of the bitlengths of the deltas, as used by the format.
+type bitLengthRuns struct {
+	freq      [64]uint64 // number of deltas of each bitlength
+	prev      uint64     // last value seen, or the offset before the first
+	started   bool
+	run       uint64 // length of the current run of equal bitlengths
+	runBn     int    // bitlength in the current run
+	longest   uint64 // length of the longest run
+	longestBn int    // bitlength in the longest run
 }
 
-// Approximates lg n choose k.
-func lgncr(n, k uint64) float64 {
-	return lgfac(n) - lgfac(k) - lgfac(n-k)
+func (r *bitLengthRuns) Add(xs []uint64) {
+	for _, x := range xs {
+		d := x - r.prev
+		if !r.started {
+			d++
+			r.started = true
+		}
+		r.prev = x
+
+		bn := bits.Len64(d) - 1
+		r.freq[bn]++
+
+		if r.run > 0 && bn == r.runBn {
+			r.run++
+		} else {
+			r.run = 1
+			r.runBn = bn
+		}
+
+		if r.run > r.longest {
+			r.longest = r.run
+			r.longestBn = bn
+		}
+	}
 }
 
-const extension = ".ncrlite"
+// Returns the most common bitlength and how often it occurs.
+func (r *bitLengthRuns) MostCommon() (int, uint64) {
+	bn := 0
+	for i, count := range r.freq {
+		if count > r.freq[bn] {
+			bn = i
+		}
+	}
+	return bn, r.freq[bn]
+}
+
+// Prints the number of values in the compressed file, which is stored
+// at its start, without decoding it.
+func doCount() int {
+	var r io.Reader = inFile
+	if *armor {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	// The start of a file written with -ordered has the number of distinct
+	// values instead.
+	var (
+		n   uint64
+		err error
+	)
+	if *ordered {
+		var xs []uint64
+		xs, err = ncrlite.DecompressWithOrder(r)
+		n = uint64(len(xs))
+	} else {
+		n, err = ncrlite.Count(r)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", inPath, err)
+		return 8
+	}
+
+	fmt.Println(n)
+	return 0
+}
 
 func doDecompress() int {
+	if *ordered {
+		return doDecompressOrdered()
+	}
+
 	var w *bufio.Writer
 
 	if outFile == nil {
@@ -56,7 +139,12 @@ func doDecompress() int {
 		w = bufio.NewWriter(outFile)
 	}
 
-	r := bufio.NewReader(inFile)
+	var r io.Reader = inFile
+	if *armor {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+	r = bufio.NewReader(r)
+
 	var l io.Writer
 
 	if *info {
@@ -70,6 +158,12 @@ func doDecompress() int {
 		return 8
 	}
 
+	// Skip the deltas, and the statistics that need them.
+	if *headerOnly {
+		fmt.Fprintf(l, "Number of values (k)  %d\n", d.Remaining())
+		return 0
+	}
+
 	var (
 		xs     [512]uint64
 		toRead []uint64
@@ -77,6 +171,7 @@ func doDecompress() int {
 
 	// For statistics when in info mode
 	k := d.Remaining()
+	runs := bitLengthRuns{prev: d.Offset()}
 
 	for d.Remaining() > 0 {
 		toRead = xs[:min(len(xs), int(d.Remaining()))]
@@ -86,6 +181,10 @@ func doDecompress() int {
 			return 9
 		}
 
+		if l != nil && k >= 2 {
+			runs.Add(toRead)
+		}
+
 		for _, x := range toRead {
 			_, err = fmt.Fprintf(w, "%d\n", x)
 			if err != nil {
@@ -102,16 +201,30 @@ func doDecompress() int {
 			N = toRead[len(toRead)-1] + 1
 		}
 
-		shannon := lgncr(N, k) / 8
+		shannon := ncrlite.ShannonBound(N, k)
 
 		fmt.Fprintf(l, "Maximum value    (N)  %d\n", N)
 		fmt.Fprintf(l, "Number of values (k)  %d\n", k)
 		fmt.Fprintf(l, "Theoretical best avg  %.1fB\n", shannon)
-		fmt.Fprintf(
-			l,
-			"Overhead              %.1f%%\n",
-			100*(float64(d.BytesRead())/float64(shannon)-1.0),
-		)
+
+		// If the set is empty or full, there is nothing to store.
+		if shannon > 0 {
+			fmt.Fprintf(
+				l,
+				"Overhead              %.1f%%\n",
+				100*(float64(d.BytesRead())/float64(shannon)-1.0),
+			)
+		} else {
+			fmt.Fprintf(l, "Overhead              n/a\n")
+		}
+
+		if k >= 2 {
+			bn, count := runs.MostCommon()
+			fmt.Fprintf(l, "Most common bitlength %d (%.1f%%)\n",
+				bn, 100*float64(count)/float64(k))
+			fmt.Fprintf(l, "Longest run           %d deltas of bitlength %d\n",
+				runs.longest, runs.longestBn)
+		}
 	}
 
 	err = w.Flush()
@@ -123,8 +236,62 @@ func doDecompress() int {
 	return 0
 }
 
-func doCompress() int {
-	var err error
+// Decompresses a file written with -ordered, which is read as a whole.
+// With -info, prints how much of it is spent on the order of the values.
+func doDecompressOrdered() int {
+	var r io.Reader = inFile
+	if *armor {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", inPath, err)
+		return 8
+	}
+
+	xs, err := ncrlite.DecompressWithOrder(bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", inPath, err)
+		return 9
+	}
+
+	if *info {
+		k := uint64(len(xs))
+
+		// The file is the values as a multiset, followed by their order.
+		var multiset bytes.Buffer
+		ncrlite.CompressMultiset(&multiset, slices.Clone(xs))
+		order := len(data) - multiset.Len()
+
+		fmt.Printf("Number of values (k)  %d\n", k)
+		fmt.Printf("Compressed size       %dB\n", len(data))
+		fmt.Printf("Order overhead        %dB (%.1f%%)\n",
+			order, 100*float64(order)/float64(len(data)))
+		fmt.Printf("Order upper bound     %.1fB\n",
+			float64(ncrlite.OrderBits(len(xs)))/8)
+	}
+
+	if outFile == nil {
+		return 0
+	}
+
+	w := bufio.NewWriter(outFile)
+	for _, x := range xs {
+		fmt.Fprintf(w, "%d\n", x)
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", outPath, err)
+		return 10
+	}
+
+	return 0
+}
+
+// Reads the values from the input file. Returns whether they are sorted,
+// and a non-zero exit code on error.
+func readInput() ([]uint64, bool, int) {
 	scanner := bufio.NewScanner(inFile)
 
 	var prev uint64
@@ -136,11 +303,11 @@ func doCompress() int {
 		cur, err := strconv.ParseUint(scanner.Text(), 10, 64)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s:%d %v\n", inPath, line, err)
-			return 5
+			return nil, false, 5
 		}
-		if line != 0 && cur == prev {
+		if line != 0 && cur == prev && !*ordered {
 			fmt.Fprintf(os.Stderr, "%s:%d dulpicate value %d\n", inPath, line, cur)
-			return 6
+			return nil, false, 6
 		}
 		if cur < prev {
 			sorted = false
@@ -150,23 +317,174 @@ func doCompress() int {
 		prev = cur
 	}
 
-	w := bufio.NewWriter(outFile)
+	return xs, sorted, 0
+}
 
-	if sorted {
-		err = ncrlite.CompressSorted(w, xs)
-	} else {
-		fmt.Fprintf(os.Stderr, "%s: input unsorted\n", inPath)
-		err = ncrlite.Compress(w, xs)
+func doAnalyze() int {
+	xs, sorted, code := readInput()
+	if code != 0 {
+		return code
 	}
 
+	if !sorted {
+		slices.Sort(xs)
+	}
+
+	report, err := ncrlite.Analyze(xs)
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", inPath, err)
+		return 6
+	}
+	for _, e := range report.Estimates {
+		fmt.Printf("%-12s %dB\n", e.Codec, e.Bytes)
+	}
+	fmt.Printf("\nRecommended  %s\n", report.Best().Codec)
+
+	return 0
+}
+
+func doCompress() int {
+	xs, sorted, code := readInput()
+	if code != 0 {
+		return code
+	}
+
+	if !sorted && !*ordered {
+		fmt.Fprintf(os.Stderr, "%s: input unsorted\n", inPath)
+		slices.Sort(xs)
+	}
+
+	if err := writeCompressed(xs); err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", outPath, err)
 		return 7
 	}
 
+	return 0
+}
+
+// Writes the compressed set xs to outFile, base64 encoded with -armor.
+// With -ordered, keeps the order of xs.
+func writeCompressed(xs []uint64) error {
+	var err error
+
+	compress := ncrlite.CompressSorted
+	if *ordered {
+		compress = ncrlite.CompressWithOrder
+	}
+
+	w := bufio.NewWriter(outFile)
+
+	var cw io.WriteCloser
+	if *armor {
+		cw = base64.NewEncoder(base64.StdEncoding, w)
+	}
+
+	if cw != nil {
+		err = compress(cw, xs)
+	} else {
+		err = compress(w, xs)
+	}
+
+	if err == nil && cw != nil {
+		err = cw.Close()
+		if err == nil {
+			err = w.WriteByte('\n')
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
 	err = w.Flush()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: write: %v\n", outPath, err)
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// Reads the compressed set from the file at path.
+func readCompressed(path string) ([]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if *armor {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	return ncrlite.Decompress(r)
+}
+
+// Concatenates the compressed files given as arguments into a single
+// one, which requires every file to start after the previous one ends,
+// unless -merge is given.
+func doConcat() int {
+	if len(flag.Args()) == 0 {
+		fmt.Fprintf(os.Stderr, "no input files\n")
+		return 2
+	}
+
+	if *ordered {
+		fmt.Fprintf(os.Stderr, "-ordered can't be combined with -concat\n")
+		return 2
+	}
+
+	var xs []uint64
+	for _, path := range flag.Args() {
+		ys, err := readCompressed(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 8
+		}
+
+		if !*merge && len(xs) > 0 && len(ys) > 0 && ys[0] <= xs[len(xs)-1] {
+			fmt.Fprintf(os.Stderr,
+				"%s: overlaps with previous input; use -merge\n", path)
+			return 14
+		}
+
+		xs = append(xs, ys...)
+	}
+
+	if *merge {
+		slices.Sort(xs)
+		xs = slices.Compact(xs)
+	}
+
+	outPath = *output
+	if outPath == "" || outPath == "-" {
+		outPath = "-"
+		outFile = os.Stdout
+
+		if term.IsTerminal(int(os.Stdout.Fd())) && !*armor {
+			fmt.Fprintf(os.Stderr, "ncrlite: I'm not writing compressed data to stdout\n")
+			return 13
+		}
+	} else {
+		if _, err := os.Stat(outPath); !*force && err == nil {
+			fmt.Fprintf(os.Stderr, "%s: already exists\n", outPath)
+			return 11
+		}
+
+		f, err := os.Create(outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: create: %v\n", outPath, err)
+			return 4
+		}
+		defer f.Close()
+		outFile = f
+	}
+
+	if err := writeCompressed(xs); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", outPath, err)
+		if outFile != os.Stdout {
+			os.Remove(outPath)
+		}
 		return 7
 	}
 
@@ -174,21 +492,43 @@ func doCompress() int {
 }
 
 func do() int {
+	if *concat {
+		return doConcat()
+	}
+
+	if len(flag.Args()) == 0 {
+		return doFile("-")
+	}
+
+	// Process each file on its own. Returns the exit code of the first
+	// file that failed.
+	ret := 0
+	for _, path := range flag.Args() {
+		code := doFile(path)
+		if code == 0 {
+			continue
+		}
+		if !*keepGoing {
+			return code
+		}
+		if ret == 0 {
+			ret = code
+		}
+	}
+
+	return ret
+}
+
+// Compresses, decompresses or inspects the file at path, or stdin if
+// path is "-", depending on the flags.
+func doFile(path string) int {
 	var (
 		err  error
 		code int
 	)
 
-	if len(flag.Args()) > 1 {
-		fmt.Fprintf(os.Stderr, "too many arguments\n")
-		return 2
-	}
-
-	if len(flag.Args()) == 0 {
-		inPath = "-"
-	} else {
-		inPath = flag.Args()[0]
-	}
+	inPath = path
+	inFile, outFile, outPath = nil, nil, ""
 
 	closeInput := false
 	closeOutput := false
@@ -241,21 +581,21 @@ func do() int {
 					outPath,
 				)
 			}
-		} else if !*info {
+		} else if !*info && !*analyze && !*count {
 			outPath = inPath + extension
 		}
 	}
 
-	if *info && !*decompress {
+	if (*info && !*decompress) || *analyze || *count {
 		outFile = nil
 	} else if outPath == "-" {
 		outFile = os.Stdout
 
-		if term.IsTerminal(int(os.Stdout.Fd())) && !*decompress && !*info {
+		if term.IsTerminal(int(os.Stdout.Fd())) && !*decompress && !*info && !*armor {
 			fmt.Fprintf(os.Stderr, "ncrlite: I'm not writing compressed data to stdout\n")
 			return 13
 		}
-	} else if !*info {
+	} else if !*info && !*analyze && !*count {
 		if _, err := os.Stat(outPath); !*force && err == nil {
 			fmt.Fprintf(os.Stderr, "%s: already exists\n", outPath)
 			return 11
@@ -270,7 +610,11 @@ func do() int {
 		closeOutput = true
 	}
 
-	if *decompress || *info {
+	if *count {
+		code = doCount()
+	} else if *analyze {
+		code = doAnalyze()
+	} else if *decompress || *info {
 		code = doDecompress()
 	} else {
 		code = doCompress()
@@ -280,7 +624,7 @@ func do() int {
 		closeInput = false
 		inFile.Close()
 
-		if !*keep && !*toStdout && code == 0 && !*info {
+		if !*keep && !*toStdout && code == 0 && !*info && !*analyze && !*count {
 			err = os.Remove(inPath)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%s: unlink: %v\n", inPath, err)
@@ -298,6 +642,8 @@ func main() {
 	getopt.Alias("c", "stdout")
 	getopt.Alias("f", "force")
 	getopt.Alias("i", "info")
+	getopt.Alias("a", "analyze")
+	getopt.Alias("o", "output")
 
 	// Work around https://github.com/rsc/getopt/issues/3
 	err := getopt.CommandLine.Parse(os.Args[1:])
@@ -305,6 +651,10 @@ func main() {
 		os.Exit(12)
 	}
 
+	if *headerOnly {
+		*info = true
+	}
+
 	ret := do()
 	os.Exit(ret)
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bwesterb/go-ncrlite"
+)
+
+// Runs doDecompress in info mode on the compressed set and returns what
+// it prints.
+func runInfo(t *testing.T, set []uint64) string {
+	path := filepath.Join(t.TempDir(), "set.ncrlite")
+	var buf bytes.Buffer
+	if err := ncrlite.CompressSorted(&buf, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	inPath, inFile, outFile = path, f, nil
+	*info = true
+	defer func() { *info = false }()
+
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+
+	code := doDecompress()
+	w.Close()
+	out := <-done
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, out)
+	}
+	return out
+}
+
+func TestInfoEdgeCases(t *testing.T) {
+	for _, set := range [][]uint64{{}, {0}, {0, 1, 2, 3}, {5, 1000}} {
+		out := runInfo(t, set)
+		if strings.Contains(out, "NaN") || strings.Contains(out, "Inf") {
+			t.Fatalf("%v: %s", set, out)
+		}
+	}
+
+	if out := runInfo(t, []uint64{}); !strings.Contains(out, "Overhead              n/a") {
+		t.Fatal(out)
+	}
+}
+
+// The statistics are of the deltas as coded, which start at the offset.
+func TestBitLengthRunsOffset(t *testing.T) {
+	runs := bitLengthRuns{prev: 1000}
+	runs.Add([]uint64{1000, 1001, 1003})
+
+	// The deltas are 1, 1 and 2.
+	if bn, count := runs.MostCommon(); bn != 0 || count != 2 {
+		t.Fatal(bn, count)
+	}
+	if runs.longest != 2 || runs.longestBn != 0 {
+		t.Fatal(runs.longest, runs.longestBn)
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	defer func() {
+		flag.Set("keep", "false")
+		flag.Set("keep-going", "false")
+	}()
+
+	for _, keepGoing := range []bool{false, true} {
+		dir := t.TempDir()
+		var paths []string
+		for _, name := range []string{"a", "b", "c"} {
+			content := "1\n5\n7\n"
+			if name == "b" {
+				content = "1\nfive\n"
+			}
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, path)
+		}
+
+		args := append([]string{"-keep"}, paths...)
+		if keepGoing {
+			args = append([]string{"-keep-going"}, args...)
+		}
+		if err := flag.CommandLine.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+
+		if code := do(); code != 5 {
+			t.Fatalf("exit code %d", code)
+		}
+
+		for _, name := range []string{"a", "b", "c"} {
+			_, err := os.Stat(filepath.Join(dir, name+extension))
+			want := name == "a" || (keepGoing && name == "c")
+			if (err == nil) != want {
+				t.Fatalf("keepGoing=%v %s: %v", keepGoing, name, err)
+			}
+		}
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	defer func() {
+		flag.Set("ordered", "false")
+		flag.Set("decompress", "false")
+	}()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a")
+	content := "9\n1\n5\n1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := flag.CommandLine.Parse([]string{"-ordered", path}); err != nil {
+		t.Fatal(err)
+	}
+	if code := do(); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+
+	err := flag.CommandLine.Parse([]string{"-ordered", "-decompress", path + extension})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := do(); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Fatalf("%q %q", got, content)
+	}
+}
@@ -0,0 +1,77 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+)
+
+// Returns the codelengths of the Huffman code for the bitlengths of the
+// deltas that CompressSorted would use for set, unless it picks Rice
+// coding: the ith entry is the length of the codeword for deltas of
+// bitlength i+1.
+//
+// Returns nil for sets with fewer than two elements, which don't have
+// a Huffman code, and for sets that aren't sorted or have duplicates.
+func CodeLengths(set []uint64) []byte {
+	if len(set) < 2 {
+		return nil
+	}
+
+	ds, err := toDeltas(set, 0)
+	if err != nil {
+		return nil
+	}
+
+	code := buildHuffmanCode(bitLengthFreqs(ds))
+	ret := make([]byte, len(code))
+	for i, entry := range code {
+		ret[i] = entry.length
+	}
+	return ret
+}
+
+// Writes a compressed version of set to w, using the given codelengths
+// for the Huffman code instead of deriving them, so that the output doesn't
+// depend on how this package builds its Huffman codes. Never uses Rice
+// coding.
+//
+// lengths can be found with CodeLengths. It's checked to be a complete
+// prefix code that covers the bitlengths of all deltas. For sets with
+// fewer than two elements, lengths is ignored.
+//
+// Assumes set is sorted and has no duplicates.
+func CompressWithCodebook(w io.Writer, set []uint64, lengths []byte) error {
+	// Without codelengths, writeSet would derive them, instead of
+	// rejecting them for sets that need them.
+	if lengths == nil {
+		lengths = []byte{}
+	}
+	return compressSorted(w, set, 0, &CompressOptions{CodeLengths: lengths})
+}
+
+var errInvalidCodebook = errors.New("Invalid codebook")
+
+// Checks whether lengths can be used as codelengths for deltas with
+// bitlengths below nbl.
+func checkCodebook(lengths []byte, nbl int) error {
+	// The number of bitlengths and the first codelength are
+	// stored in six bits.
+	if len(lengths) == 0 || len(lengths) > 64 || lengths[0] >= 64 {
+		return errInvalidCodebook
+	}
+
+	if len(lengths) == 1 {
+		// Trivial code for when all deltas are one.
+		if lengths[0] != 0 {
+			return errInvalidCodebook
+		}
+	} else if err := checkCodeLengths(lengths); err != nil {
+		return errInvalidCodebook
+	}
+
+	if nbl > len(lengths) {
+		return errors.New("Codebook doesn't cover all deltas")
+	}
+
+	return nil
+}
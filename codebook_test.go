@@ -0,0 +1,160 @@
+package ncrlite
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestCompressWithCodebook(t *testing.T) {
+	for _, set := range [][]uint64{
+		{},
+		{5},
+		{1, 2, 3, 4},
+		sample(100000, 1000),
+	} {
+		slices.Sort(set)
+
+		lengths := CodeLengths(set)
+
+		var buf bytes.Buffer
+		if err := CompressWithCodebook(&buf, set, lengths); err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := NewDecompressor(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lengths) > 1 && d.NumBitLengths() != len(lengths) {
+			t.Fatalf("%d ≠ %d", d.NumBitLengths(), len(lengths))
+		}
+		ret := make([]uint64, d.Remaining())
+		if err := d.Read(ret); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ret, set) {
+			t.Fatalf("%v %v", ret, set)
+		}
+	}
+
+	set := []uint64{0, 1, 3, 7, 15, 16}
+
+	// A balanced code for four bitlengths, which is not optimal for set.
+	var buf bytes.Buffer
+	if err := CompressWithCodebook(&buf, set, []byte{2, 2, 2, 2}); err != nil {
+		t.Fatal(err)
+	}
+	ret, err := Decompress(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ret, set) {
+		t.Fatalf("%v %v", ret, set)
+	}
+
+	for _, lengths := range [][]byte{
+		nil,
+		{0},          // only for consecutive sets
+		{1, 2, 2},    // doesn't cover bitlength 4
+		{2, 2, 2, 3}, // incomplete
+		{1, 1, 2, 2}, // oversubscribed
+	} {
+		buf.Reset()
+		if CompressWithCodebook(&buf, set, lengths) == nil {
+			t.Fatalf("%v: expected error", lengths)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%v: wrote %d bytes", lengths, buf.Len())
+		}
+	}
+
+	if lengths := CodeLengths([]uint64{3, 1}); lengths != nil {
+		t.Fatal(lengths)
+	}
+}
+
+// Checks that the prefix table is allocated at its final size upfront,
+// for codes up to the longest codewords.
+func TestLutSize(t *testing.T) {
+	for _, k := range []int{2, 9, 20, 64} {
+		// The code 0, 10, 110, …, with two codewords of the longest
+		// length, and a set with a delta of each bitlength.
+		lengths := make([]byte, k)
+		set := make([]uint64, k)
+		x := uint64(0)
+		for i := range lengths {
+			lengths[i] = byte(min(i+1, k-1))
+			if i > 0 {
+				x += 1 << i
+			}
+			set[i] = x
+		}
+
+		var buf bytes.Buffer
+		if err := CompressWithCodebook(&buf, set, lengths); err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := NewDecompressor(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(d.tree) != cap(d.tree) {
+			t.Fatalf("k=%d: %d ≠ %d", k, len(d.tree), cap(d.tree))
+		}
+
+		ret := make([]uint64, d.Remaining())
+		if err := d.Read(ret); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ret, set) {
+			t.Fatalf("%v %v", ret, set)
+		}
+	}
+}
+
+// Packs and unpacks the codebook of a set with deltas of all 64 bitlengths,
+// and for comparison, also builds the prefix table from it.
+func BenchmarkCodebookRoundTrip(b *testing.B) {
+	freq := make([]int, 64)
+	for i := range freq {
+		freq[i] = 1 + (i*37)%64
+	}
+	code := buildHuffmanCode(freq)
+
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	code.Pack(w, 0)
+	w.Close()
+	xs := buf.Bytes()
+
+	b.Run("pack", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			w := NewBitWriter(io.Discard)
+			code.Pack(w, 0)
+			w.Close()
+		}
+	})
+
+	b.Run("unpack", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			br := newSliceBitReader(xs)
+			n, h0 := br.ReadUvarint()+1, byte(br.ReadUvarint())
+			if _, err := unpackCodeLengths(br, n, h0, 0, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("unpack+lut", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			br := newSliceBitReader(xs)
+			n, h0 := br.ReadUvarint()+1, byte(br.ReadUvarint())
+			if _, err := unpackHuffmanTree(br, n, h0, 0, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+	"slices"
+)
+
+// The values column is coded like the deltas, except that the values can
+// be zero: we use the bitlength in the usual sense, which ranges from
+// 0 to 64. Thus the fields at the start of its codebook are seven bits.
+const columnWidth = 7
+
+var errColumnLength = errors.New("Keys and values differ in length")
+
+// Writes a compressed version of keys and their associated vals to w.
+//
+// The keys are compressed as a set; the values are compressed separately
+// with their own Huffman code for their bitlengths. Returns an error if
+// keys isn't sorted or has duplicates.
+func CompressColumns(w io.Writer, keys, vals []uint64) error {
+	bw := NewBitWriter(w)
+	if err := writeColumns(bw, keys, vals); err != nil {
+		return err
+	}
+	return bw.Close()
+}
+
+// Writes keys and vals as CompressColumns does to bw, without closing it.
+//
+// Returns an error, before writing anything, if keys isn't sorted or has
+// duplicates.
+func writeColumns(bw *BitWriter, keys, vals []uint64) error {
+	if len(keys) != len(vals) {
+		return errColumnLength
+	}
+
+	n := len(keys)
+	ds, err := toDeltas(keys, 0)
+	if err != nil && n >= 2 {
+		return err
+	}
+
+	bw.WriteUvarint(uint64(n))
+
+	if n == 0 {
+		return nil
+	}
+
+	var keyCode htCode
+	if n >= 2 {
+		keyCode = writeCodebook(bw, ds, 0, nil)
+	}
+
+	// Codebook for the bitlengths of the values
+	valCode := buildHuffmanCode(valueFreqs(vals))
+	valCode.Pack(bw, columnWidth)
+
+	// Interleave keys and values, so they can be read together.
+	for i := 0; i < n; i++ {
+		if n == 1 {
+			bw.WriteUvarint(keys[0])
+		} else {
+			writeDelta(bw, keyCode, ds[i])
+		}
+
+		writeValue(bw, valCode, vals[i])
+	}
+
+	if n >= 2 {
+		bw.WriteBits(EndMarker, 8)
+	}
+
+	return nil
+}
+
+// Reads keys and their associated values written by CompressColumns
+// incrementally.
+type ColumnsDecompressor struct {
+	d    *Decompressor // for the keys
+	br   *BitReader
+	vals htLut // Huffman tree for the bitlengths of the values
+}
+
+// Returns a new ColumnsDecompressor that reads keys and values from r.
+func NewColumnsDecompressor(r io.Reader) (*ColumnsDecompressor, error) {
+	return newColumnsDecompressor(NewBitReader(r))
+}
+
+// Returns a new ColumnsDecompressor that reads keys and values from br,
+// which may be read further after the last of them.
+func newColumnsDecompressor(br *BitReader) (*ColumnsDecompressor, error) {
+	// As the values are interleaved with the keys, the Decompressor
+	// for the keys shouldn't look for the endmarker.
+	d, err := newDecompressor(br, &DecompressOptions{NoEndMarker: true})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ColumnsDecompressor{d: d, br: br}
+	if d.size == 0 {
+		return c, nil
+	}
+
+	c.vals, err = readValueCodebook(br)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Returns the number of values of each bitlength.
+func valueFreqs(vals []uint64) []int {
+	freq := make([]int, 0, 65)
+	for _, v := range vals {
+		bn := bits.Len64(v)
+		for bn >= len(freq) {
+			freq = append(freq, 0)
+		}
+		freq[bn]++
+	}
+	return freq
+}
+
+// Returns the number of bits used by the packed codebook and the values
+// encoded with it, for values with the given bitlength frequencies.
+func valueBits(code htCode, freq []int) uint64 {
+	ret := code.packedBits(columnWidth)
+	for bn, entry := range code {
+		ret = satAdd(ret, satMul(uint64(freq[bn]),
+			uint64(entry.length)+uint64(max(bn-1, 0))))
+	}
+	return ret
+}
+
+// Writes v to bw: the codeword for its bitlength, and then its bits but
+// the implied most significant one.
+func writeValue(bw *BitWriter, code htCode, v uint64) {
+	bn := bits.Len64(v)
+	bw.WriteBits(code[bn].code, int(code[bn].length))
+	if bn >= 2 {
+		bw.WriteBits(v^(1<<(bn-1)), bn-1)
+	}
+}
+
+// Reads the codebook for the bitlengths of values packed with columnWidth.
+func readValueCodebook(br *BitReader) (htLut, error) {
+	n := br.ReadBits(columnWidth) + 1
+	h0 := byte(br.ReadBits(columnWidth))
+	if n > 65 {
+		return nil, errors.New("invalid codebook for values")
+	}
+	return unpackHuffmanTree(br, n, h0, columnWidth, nil)
+}
+
+// Reads a value written by writeValue, given the Huffman tree for its
+// bitlength.
+func readValue(br *BitReader, lut htLut) uint64 {
+	bn := lut.ReadValue(br)
+	if bn <= 1 {
+		return uint64(bn)
+	}
+	return br.ReadBits(bn-1) | (1 << (bn - 1))
+}
+
+// Returns the number of keys remaining to be decompressed.
+func (c *ColumnsDecompressor) Remaining() uint64 {
+	return c.d.Remaining()
+}
+
+// Fill keys and vals, which must be of the same length, with the next keys
+// and their associated values.
+//
+// If fewer than len(keys) keys remain, returns ErrNoMore without
+// reading any.
+func (c *ColumnsDecompressor) Read(keys, vals []uint64) error {
+	if len(keys) != len(vals) {
+		return errColumnLength
+	}
+
+	if c.d.Remaining() < uint64(len(keys)) {
+		return ErrNoMore
+	}
+
+	for i := range keys {
+		if err := c.d.Read(keys[i : i+1]); err != nil {
+			return err
+		}
+
+		vals[i] = readValue(c.br, c.vals)
+	}
+
+	if c.d.Remaining() == 0 && c.d.size >= 2 && len(keys) > 0 {
+		if c.br.ReadBits(8) != EndMarker {
+			return errors.New("Incorrect endmarker")
+		}
+	}
+
+	return c.br.Err()
+}
+
+// Decompresses keys and their associated values written by CompressColumns
+// from r.
+func DecompressColumns(r io.Reader) ([]uint64, []uint64, error) {
+	c, err := NewColumnsDecompressor(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.readAll()
+}
+
+// Reads all remaining keys and values.
+func (c *ColumnsDecompressor) readAll() ([]uint64, []uint64, error) {
+	if c.Remaining() > MaxSetSize {
+		return nil, nil, ErrTooLarge
+	}
+
+	keys := make([]uint64, 0, min(c.Remaining(), decompressChunk))
+	vals := make([]uint64, 0, min(c.Remaining(), decompressChunk))
+	for c.Remaining() > 0 {
+		n := int(min(c.Remaining(), uint64(max(len(keys), decompressChunk))))
+		keys = slices.Grow(keys, n)
+		vals = slices.Grow(vals, n)
+		err := c.Read(keys[len(keys):len(keys)+n], vals[len(vals):len(vals)+n])
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = keys[:len(keys)+n]
+		vals = vals[:len(vals)+n]
+	}
+
+	return keys, vals, nil
+}
@@ -0,0 +1,72 @@
+package ncrlite
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestColumns(t *testing.T) {
+	for _, k := range []int{0, 1, 2, 3, 1000} {
+		keys := sample(1000000, k)
+		slices.Sort(keys)
+
+		vals := make([]uint64, k)
+		for i := range vals {
+			switch i % 4 {
+			case 0:
+				vals[i] = 0
+			case 1:
+				vals[i] = 0xffffffffffffffff
+			default:
+				vals[i] = rand.Uint64() >> rand.Intn(64)
+			}
+		}
+
+		buf := new(bytes.Buffer)
+		err := CompressColumns(buf, keys, vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys2, vals2, err := DecompressColumns(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(keys, keys2) {
+			t.Fatalf("%v %v", keys, keys2)
+		}
+		if !slices.Equal(vals, vals2) {
+			t.Fatalf("%v %v", vals, vals2)
+		}
+	}
+}
+
+func TestColumnsIncremental(t *testing.T) {
+	keys := []uint64{3, 5, 8, 13, 21}
+	vals := []uint64{1, 1, 2, 3, 5}
+
+	buf := new(bytes.Buffer)
+	CompressColumns(buf, keys, vals)
+
+	c, err := NewColumnsDecompressor(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]uint64, 1)
+	val := make([]uint64, 1)
+	for i := range keys {
+		if err := c.Read(key, val); err != nil {
+			t.Fatal(err)
+		}
+		if key[0] != keys[i] || val[0] != vals[i] {
+			t.Fatalf("(%d, %d) ≠ (%d, %d)", key[0], val[0], keys[i], vals[i])
+		}
+	}
+
+	if err := c.Read(key, val); err != ErrNoMore {
+		t.Fatal(err)
+	}
+}
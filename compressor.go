@@ -0,0 +1,199 @@
+package ncrlite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// Number of bytes of spilled deltas the Compressor keeps in memory before
+// moving them to a temporary file. A variable for testing.
+var maxSpillMemory = 1 << 23
+
+var errCompressorClosed = errors.New("Compressor is closed")
+
+// Compresses a set from sorted values that are added one at a time,
+// without holding them in memory.
+//
+// The codebook at the start of the stream depends on all deltas, so the
+// Compressor makes two passes. While values are added, it keeps
+// statistics, and spills the deltas as uvarints: in memory at first, and
+// to a temporary file once that gets large. On Close, it writes the set,
+// which is the same as what CompressSorted writes.
+type Compressor struct {
+	w      io.Writer
+	n      uint64
+	first  uint64
+	prev   uint64
+	err    error
+	closed bool
+
+	freq []int      // number of deltas of each bitlength
+	sum  float64    // sum of the deltas minus one
+	rice [64]uint64 // sum of the deltas minus one shifted right by k
+
+	mem   bytes.Buffer  // spilled deltas, until there are too many
+	file  *os.File      // spilled deltas after that
+	spill *bufio.Writer // writes to file
+}
+
+// Returns a Compressor that writes the compressed set to w on Close.
+func NewCompressor(w io.Writer) *Compressor {
+	return &Compressor{w: w}
+}
+
+// Adds x to the set. Values have to be added in increasing order.
+func (c *Compressor) Add(x uint64) error {
+	if c.closed {
+		return errCompressorClosed
+	}
+	if c.err != nil {
+		return c.err
+	}
+
+	switch {
+	case c.n == 0:
+		// The first delta is x+1, which overflows for 2⁶⁴-1. That's only
+		// a problem if another value follows, which can't be larger.
+		c.first = x
+	case x <= c.prev:
+		return errNotSet
+	case c.n == 1:
+		c.addDelta(c.first + 1)
+		c.addDelta(x - c.prev)
+	default:
+		c.addDelta(x - c.prev)
+	}
+
+	c.prev = x
+	c.n++
+	return c.err
+}
+
+// Keeps statistics on the delta d, and spills it.
+func (c *Compressor) addDelta(d uint64) {
+	bn := bits.Len64(d) - 1
+	for bn >= len(c.freq) {
+		c.freq = append(c.freq, 0)
+	}
+	c.freq[bn]++
+
+	c.sum += float64(d - 1)
+	for k, q := 0, d-1; q != 0; k, q = k+1, q>>1 {
+		c.rice[k] = satAdd(c.rice[k], q)
+	}
+
+	// Appending to the available buffer saves an allocation.
+	if c.file != nil {
+		_, c.err = c.spill.Write(
+			binary.AppendUvarint(c.spill.AvailableBuffer(), d))
+		return
+	}
+
+	c.mem.Write(binary.AppendUvarint(c.mem.AvailableBuffer(), d))
+	if c.mem.Len() < maxSpillMemory {
+		return
+	}
+
+	c.file, c.err = os.CreateTemp("", "ncrlite-")
+	if c.err != nil {
+		return
+	}
+	c.spill = bufio.NewWriter(c.file)
+	_, c.err = c.spill.Write(c.mem.Bytes())
+	c.mem = bytes.Buffer{}
+}
+
+// Closes c without writing anything, because of err, which is returned.
+func (c *Compressor) abort(err error) error {
+	if c.err == nil {
+		c.err = err
+	}
+	c.Close()
+	return err
+}
+
+// Writes the compressed set to the underlying writer, and removes the
+// temporary file, if any.
+func (c *Compressor) Close() error {
+	if c.closed {
+		return errCompressorClosed
+	}
+	c.closed = true
+
+	if c.file != nil {
+		defer func() {
+			c.file.Close()
+			os.Remove(c.file.Name())
+		}()
+	}
+
+	if c.err != nil {
+		return c.err
+	}
+
+	bw := NewBitWriter(c.w)
+	bw.WriteUvarint(c.n)
+
+	if c.n <= 1 {
+		if c.n == 1 {
+			bw.WriteUvarint(c.first)
+		}
+		return bw.Close()
+	}
+
+	// Rewind the spilled deltas.
+	var r io.ByteReader = &c.mem
+	if c.file != nil {
+		if err := c.spill.Flush(); err != nil {
+			return err
+		}
+		if _, err := c.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = bufio.NewReader(c.file)
+	}
+
+	// Pick the code as writeSet does.
+	code := buildHuffmanCode(c.freq)
+	k, riceSize := minimizeRice(c.sum/float64(c.n), func(k uint8) uint64 {
+		return satAdd(c.rice[k], satMul(c.n, uint64(k)+1))
+	})
+	rice := riceSmaller(riceSize, c.freq, code, 0)
+
+	if rice {
+		bw.WriteBits(0, 6)
+		bw.WriteBits(uint64(flagRice), 6)
+		bw.WriteBits(uint64(k), 6)
+	} else {
+		code.Pack(bw, codebookWidth(0))
+	}
+
+	var buf [512]uint64
+	for left := c.n; left > 0; {
+		ds := buf[:min(left, uint64(len(buf)))]
+		for i := range ds {
+			d, err := binary.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			ds[i] = d
+		}
+		left -= uint64(len(ds))
+
+		if rice {
+			writeRice(bw, ds, k)
+		} else {
+			for _, d := range ds {
+				writeDelta(bw, code, d)
+			}
+		}
+	}
+
+	bw.WriteBits(EndMarker, 8)
+	return bw.Close()
+}
@@ -0,0 +1,56 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	sets := [][]uint64{
+		{},
+		{0},
+		{1<<64 - 1},
+		{1, 2, 3},
+		{0, 1<<64 - 1},
+		sample(1000000, 10000), // Rice code
+		heavyTailedSet(10000),  // Huffman code
+	}
+
+	// Also spill to a temporary file.
+	defer func(old int) { maxSpillMemory = old }(maxSpillMemory)
+	for _, spill := range []int{maxSpillMemory, 100} {
+		maxSpillMemory = spill
+
+		for _, set := range sets {
+			slices.Sort(set)
+
+			var buf, want bytes.Buffer
+			c := NewCompressor(&buf)
+			for _, x := range set {
+				if err := c.Add(x); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The same as CompressSorted, so Decompress reads it.
+			CompressSorted(&want, set)
+			if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+				t.Fatalf("spill=%d %v: output differs", spill, set[:min(len(set), 10)])
+			}
+		}
+	}
+
+	c := NewCompressor(new(bytes.Buffer))
+	c.Add(5)
+	if err := c.Add(5); err != errNotSet {
+		t.Fatal(err)
+	}
+	c.Close()
+	if err := c.Add(6); err != errCompressorClosed {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+package ncrlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+var errCursorPeeked = errors.New(
+	"Can't save cursor while ReadUntil holds a value read ahead")
+
+// Returns an opaque cursor that records the position of d in the stream,
+// with which decompression can be resumed later using RestoreDecompressor.
+//
+// Fails if ReadUntil stopped on a value exceeding its ceiling, until that
+// value has been read.
+func (d *Decompressor) SaveCursor() ([]byte, error) {
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	if err := d.br.Err(); err != nil {
+		return nil, err
+	}
+
+	if d.peeked {
+		return nil, errCursorPeeked
+	}
+
+	// Position in bits from the start of the stream.
+	pos := uint64(d.br.total)*8 - uint64(d.br.size)
+
+	started := uint64(0)
+	if d.started {
+		started = 1
+	}
+
+	var ret []byte
+	ret = binary.AppendUvarint(ret, pos)
+	ret = binary.AppendUvarint(ret, d.prev)
+	ret = binary.AppendUvarint(ret, d.remaining)
+	ret = binary.AppendUvarint(ret, started)
+	return ret, nil
+}
+
+// Returns a Decompressor that continues where the Decompressor was, for which
+// cursor was returned by SaveCursor.
+//
+// The stream must start at the current offset of r. The header is read
+// again, after which r is seeked to the position recorded in the cursor.
+func RestoreDecompressor(r io.ReadSeeker, cursor []byte) (*Decompressor, error) {
+	var fields [4]uint64
+	for i := range fields {
+		x, n := binary.Uvarint(cursor)
+		if n <= 0 {
+			return nil, errInvalidCursor
+		}
+		fields[i] = x
+		cursor = cursor[n:]
+	}
+	pos, prev, remaining, started := fields[0], fields[1], fields[2], fields[3]
+
+	if len(cursor) != 0 || started > 1 {
+		return nil, errInvalidCursor
+	}
+
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining > d.size {
+		return nil, errInvalidCursor
+	}
+
+	_, err = r.Seek(start+int64(pos/8), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	d.br = NewBitReader(r)
+	d.br.total = int(pos / 8)
+	d.br.ReadBits(byte(pos % 8))
+	if err := d.br.Err(); err != nil {
+		return nil, err
+	}
+
+	d.prev = prev
+	d.remaining = remaining
+	d.started = started == 1
+
+	return d, nil
+}
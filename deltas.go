@@ -0,0 +1,69 @@
+package ncrlite
+
+import "errors"
+
+var errNotSet = errors.New("Set has duplicates or is not sorted")
+
+// Returns the deltas of the sorted set as used by the format: the first is
+// the smallest value plus one, and the others are the differences between
+// consecutive values. Thus no delta is zero. The gaps of ReadGaps start
+// with the smallest value itself instead.
+//
+// Returns an error if sorted isn't sorted, has duplicates, or starts
+// with 2⁶⁴-1.
+func ToDeltas(sorted []uint64) ([]uint64, error) {
+	return toDeltas(sorted, 0)
+}
+
+// Returns the sorted set with the given deltas, as returned by ToDeltas.
+//
+// Returns an error if a delta is zero or the values overflow.
+func FromDeltas(deltas []uint64) ([]uint64, error) {
+	ret := make([]uint64, len(deltas))
+	for i, d := range deltas {
+		if d == 0 {
+			return nil, errors.New("Delta is zero")
+		}
+
+		if i == 0 {
+			ret[0] = d - 1
+			continue
+		}
+
+		ret[i] = ret[i-1] + d
+		if ret[i] < ret[i-1] {
+			return nil, ErrOverflow
+		}
+	}
+	return ret, nil
+}
+
+// Returns the deltas of set as ToDeltas, but computed from the values
+// minus offset, which must be at most the smallest value.
+func toDeltas(set []uint64, offset uint64) ([]uint64, error) {
+	if len(set) == 0 {
+		return []uint64{}, nil
+	}
+
+	ds := make([]uint64, len(set))
+
+	ds[0] = set[0] - offset + 1
+	if ds[0] == 0 {
+		// The first value is 2⁶⁴-1, which is fine for a set on its own,
+		// which writeSet stores without deltas. Any next value can't
+		// be larger.
+		if len(set) > 1 {
+			return nil, errNotSet
+		}
+		return nil, ErrOverflow
+	}
+
+	for i := 1; i < len(set); i++ {
+		if set[i] <= set[i-1] {
+			return nil, errNotSet
+		}
+		ds[i] = set[i] - set[i-1]
+	}
+
+	return ds, nil
+}
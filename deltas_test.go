@@ -0,0 +1,65 @@
+package ncrlite
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestDeltas(t *testing.T) {
+	random := sample(100000, 1000)
+	slices.Sort(random)
+
+	for _, set := range [][]uint64{
+		{},
+		{0},
+		{math.MaxUint64 - 1},
+		{0, math.MaxUint64},
+		{0, 1, 2},
+		{math.MaxInt64, math.MaxInt64 + 1},
+		random,
+	} {
+		ds, err := ToDeltas(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(set) > 0 && ds[0] != set[0]+1 {
+			t.Fatalf("%d %d", ds[0], set[0])
+		}
+		ret, err := FromDeltas(ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(set, ret) {
+			t.Fatalf("%v %v", set, ret)
+		}
+	}
+
+	for _, set := range [][]uint64{
+		{math.MaxUint64},
+		{1, 0},
+		{1, 1},
+		{math.MaxUint64, 0},
+		{math.MaxUint64, math.MaxUint64},
+	} {
+		if _, err := ToDeltas(set); err == nil {
+			t.Fatalf("%v: expected error", set)
+		}
+
+		var buf bytes.Buffer
+		if len(set) > 1 && CompressSorted(&buf, set) != errNotSet {
+			t.Fatalf("%v: expected error", set)
+		}
+	}
+
+	for _, ds := range [][]uint64{
+		{0},
+		{1, 0},
+		{math.MaxUint64, 2},
+	} {
+		if _, err := FromDeltas(ds); err == nil {
+			t.Fatalf("%v: expected error", ds)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package ncrlite
+
+// Fills dst with the next decompressed values converted to float64, until
+// either dst is full or no values remain. Returns the number of values
+// read.
+//
+// Values above 2⁵³ are rounded to the nearest float64, so that distinct
+// values might convert to the same float64.
+func (d *Decompressor) ReadFloat64(dst []float64) (int, error) {
+	if err := d.readHeader(); err != nil {
+		return 0, err
+	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+
+	n := int(min(uint64(len(dst)), d.remaining))
+	for i := 0; i < n; {
+		xs := buf[:min(len(buf), n-i)]
+		if err := d.Read(xs); err != nil {
+			return i, err
+		}
+
+		for _, x := range xs {
+			dst[i] = float64(x)
+			i++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestReadFloat64(t *testing.T) {
+	set := sample(100000, 2000)
+	set = append(set, 1<<53+1, 1<<64-1)
+	slices.Sort(set)
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+
+	d, err := NewDecompressor(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []float64
+	dst := make([]float64, 700)
+	for {
+		n, err := d.ReadFloat64(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		got = append(got, dst[:n]...)
+	}
+
+	if len(got) != len(set) {
+		t.Fatalf("%d %d", len(got), len(set))
+	}
+	for i, x := range set {
+		if got[i] != float64(x) {
+			t.Fatalf("%d: %v %v", i, got[i], x)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ncrlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Describes a compressed set without decoding it. Written after the set
+// with the Footer option, and read by ReadFooter, and by NewDecompressor
+// from an io.ReadSeeker.
+type Footer struct {
+	// Version of the layout of the footer, which is 1.
+	Version uint64
+
+	// Flags of the variant of the format the set is written in, as
+	// described in the README, which are zero for the basic format.
+	Flags byte
+
+	// Number of values in the set, and the smallest and largest value.
+	// For the empty set, Min and Max are zero.
+	Count, Min, Max uint64
+}
+
+// Returns the name of the codec of the deltas: "huffman" or "rice".
+func (f *Footer) Codec() string {
+	if f.Flags&flagRice != 0 {
+		return "rice"
+	}
+	return "huffman"
+}
+
+// Marks the end of a footer, after its length.
+const footerMagic = "NCRF"
+
+const footerVersion = 1
+
+var errNoFooter = errors.New("No footer")
+
+// Writes the footer for set, written with the given flags, aligned to a
+// byte. It ends with its length in a byte and footerMagic, so that
+// it can be found from the end of the stream.
+func writeFooter(bw *BitWriter, set []uint64, flags byte) {
+	f := Footer{
+		Version: footerVersion,
+		Flags:   flags,
+		Count:   uint64(len(set)),
+	}
+	if len(set) > 0 {
+		f.Min, f.Max = set[0], set[len(set)-1]
+	}
+
+	buf := binary.AppendUvarint(nil, f.Version)
+	buf = append(buf, f.Flags)
+	buf = binary.AppendUvarint(buf, f.Count)
+	buf = binary.AppendUvarint(buf, f.Min)
+	buf = binary.AppendUvarint(buf, f.Max)
+	buf = append(buf, byte(len(buf)))
+	buf = append(buf, footerMagic...)
+
+	bw.WriteBits(0, (8-bw.offset%8)%8)
+	for _, b := range buf {
+		bw.WriteBits(uint64(b), 8)
+	}
+}
+
+// Reads the footer at the end of r, which is written with the Footer
+// option, and seeks back to where r was, also if there's none.
+func ReadFooter(r io.ReadSeeker) (ret *Footer, err error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _, serr := r.Seek(start, io.SeekStart); serr != nil && err == nil {
+			ret, err = nil, serr
+		}
+	}()
+
+	var trailer [1 + len(footerMagic)]byte
+	if _, err := r.Seek(-int64(len(trailer)), io.SeekEnd); err != nil {
+		return nil, errNoFooter
+	}
+	if _, err := io.ReadFull(r, trailer[:]); err != nil {
+		return nil, err
+	}
+	if string(trailer[1:]) != footerMagic {
+		return nil, errNoFooter
+	}
+
+	buf := make([]byte, trailer[0])
+	_, err = r.Seek(-int64(len(trailer)+len(buf)), io.SeekEnd)
+	if err != nil {
+		return nil, errNoFooter
+	}
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	var f Footer
+	var n int
+	f.Version, n = binary.Uvarint(buf)
+	if n <= 0 || f.Version != footerVersion || n >= len(buf) {
+		return nil, errors.New("Unsupported footer")
+	}
+	f.Flags = buf[n]
+	buf = buf[n+1:]
+	for _, x := range []*uint64{&f.Count, &f.Min, &f.Max} {
+		*x, n = binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errors.New("Corrupt footer")
+		}
+		buf = buf[n:]
+	}
+
+	return &f, nil
+}
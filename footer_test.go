@@ -0,0 +1,103 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestFooter(t *testing.T) {
+	for _, set := range [][]uint64{
+		{},
+		{42},
+		{0, 1, 2, 3, 4, 5, 6, 7, 1007},
+		sample(100000, 1000),
+	} {
+		slices.Sort(set)
+		buf := new(bytes.Buffer)
+		err := CompressSortedWithOptions(buf, set, &CompressOptions{Footer: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bytes.NewReader(buf.Bytes())
+
+		f, err := ReadFooter(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Count != uint64(len(set)) {
+			t.Fatalf("%v: %+v", set, f)
+		}
+		if len(set) > 0 && (f.Min != set[0] || f.Max != set[len(set)-1]) {
+			t.Fatalf("%v: %+v", set, f)
+		}
+
+		// The set itself reads as usual.
+		d, err := NewDecompressor(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "huffman"
+		if d.flags&flagRice != 0 {
+			want = "rice"
+		}
+		if f.Codec() != want {
+			t.Fatalf("%v: %s", set, f.Codec())
+		}
+		got := make([]uint64, d.Remaining())
+		if err := d.Read(got); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("%v %v", got, set)
+		}
+
+		// NewDecompressor picks up the footer if it can seek.
+		d, err = NewDecompressor(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Footer() == nil || *d.Footer() != *f {
+			t.Fatalf("%v: %+v", set, d.Footer())
+		}
+		d, err = NewDecompressor(bytes.NewBuffer(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Footer() != nil {
+			t.Fatalf("%v: %+v", set, d.Footer())
+		}
+	}
+
+	// A set of one value is written without extended header, and so its
+	// footer has no flags either.
+	buf := new(bytes.Buffer)
+	compressSorted(buf, []uint64{42}, flagOffset, &CompressOptions{Footer: true})
+	d, err := NewDecompressor(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Footer() == nil || d.Footer().Flags != 0 {
+		t.Fatalf("%+v", d.Footer())
+	}
+
+	// The footer at the end belongs to the second set, not the first.
+	buf.Reset()
+	CompressSorted(buf, []uint64{1, 2, 3})
+	r := bytes.NewReader(buf.Bytes())
+	if _, err := ReadFooter(r); err != errNoFooter {
+		t.Fatal(err)
+	}
+	if r.Len() != buf.Len() {
+		t.Fatal("didn't seek back")
+	}
+	CompressSortedWithOptions(buf, []uint64{1, 2, 3, 4},
+		&CompressOptions{Footer: true})
+	d, err = NewDecompressor(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Footer() != nil {
+		t.Fatalf("%+v", d.Footer())
+	}
+}
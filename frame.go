@@ -0,0 +1,331 @@
+package ncrlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Writes a compressed version of set to w, prefixed by its length in bytes
+// as uvarint, so that it can be read from a stream of frames by ReadFrame.
+//
+// Assumes set is sorted and has no duplicates.
+func WriteFrame(w io.Writer, set []uint64) error {
+	var buf bytes.Buffer
+	if err := CompressSorted(&buf, set); err != nil {
+		return err
+	}
+
+	var hdr [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(buf.Len()))
+	if _, err := w.Write(hdr[:n]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var (
+	errPartTooSmall = errors.New("Part too small for a single value")
+	errSkipUnframed = errors.New("Can't skip a set without framing")
+)
+
+// Writes set as frames, as with WriteFrame, into parts of at most maxBytes
+// bytes each. Calls newPart to open the ith part, starting at zero, and
+// closes it before opening the next. Each part holds a single frame with
+// as many values as fit. Read the parts in order with ReadFrame or
+// NewFramedDecompressor.
+//
+// Assumes set is sorted and has no duplicates.
+func CompressSplit(set []uint64, maxBytes int,
+	newPart func(i int) (io.WriteCloser, error)) error {
+	for i, part := 0, 0; i < len(set) || part == 0; part++ {
+		n, err := largestFrame(set[i:], maxBytes)
+		if err != nil {
+			return err
+		}
+
+		w, err := newPart(part)
+		if err != nil {
+			return err
+		}
+		if err := WriteFrame(w, set[i:i+n]); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		i += n
+	}
+
+	return nil
+}
+
+// Returns the largest n such that the frame of set[:n] takes at most
+// maxBytes. We search for it, as the size of a frame grows with the number
+// of values. It doesn't do so strictly, but that only costs a few bytes.
+func largestFrame(set []uint64, maxBytes int) (int, error) {
+	fits := func(n int) (bool, error) {
+		size, err := CompressedLen(set[:n])
+		if err != nil {
+			return false, err
+		}
+		return size+int64(uvarintLen(uint64(size))) <= int64(maxBytes), nil
+	}
+
+	if ok, err := fits(len(set)); ok || err != nil {
+		return len(set), err
+	}
+	if ok, err := fits(1); !ok || err != nil {
+		if err == nil {
+			err = errPartTooSmall
+		}
+		return 0, err
+	}
+
+	// Now set[:lo] fits, but set[:hi] doesn't.
+	lo, hi := 1, 2
+	for hi < len(set) {
+		ok, err := fits(hi)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		lo, hi = hi, 2*hi
+	}
+	hi = min(hi, len(set))
+
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// Reads a set written by WriteFrame from r. Doesn't read beyond the
+// end of the frame, so that the next frame can be read from r.
+//
+// Returns io.EOF if there are no more frames.
+func ReadFrame(r io.Reader) ([]uint64, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// The size isn't to be trusted, so don't allocate it upfront.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(min(size, 1<<62))); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return Decompress(&buf)
+}
+
+// Reads the sets in a stream of frames written by WriteFrame one by one,
+// or in a stream of sets written one after the other by CompressSorted.
+type MultiDecompressor struct {
+	// If set, called with the index of the next frame, starting at zero,
+	// when Read advances to it.
+	OnFrame func(index int)
+
+	r       io.Reader
+	br      io.ByteReader
+	bits    *BitReader       // if set, the sets aren't framed
+	frame   io.LimitedReader // rest of the current frame
+	index   int              // index of the current frame
+	cur     *Decompressor    // for the current frame, if any
+	skipped []int
+}
+
+// Returns a MultiDecompressor that reads frames written by WriteFrame
+// from r.
+func NewFramedDecompressor(r io.Reader) *MultiDecompressor {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	return &MultiDecompressor{r: r, br: br, index: -1}
+}
+
+// Returns a MultiDecompressor that reads sets written one after the other
+// by CompressSorted from r, for instance by calling it repeatedly with the
+// same writer. Each set is a frame.
+//
+// As there's no framing, the end of a set is only found by decoding it,
+// and the sets can't have an index or footer.
+func NewMultiDecompressor(r io.Reader) *MultiDecompressor {
+	return &MultiDecompressor{bits: NewBitReader(r), index: -1}
+}
+
+// Advances to the next frame, skipping what's left of the current one,
+// and returns a Decompressor for its set, which is valid until the next
+// call. Returns false if there are no frames left.
+//
+// If the frame is corrupt, returns an error. Then call SkipFrame to
+// continue with the next frame.
+func (m *MultiDecompressor) Next() (*Decompressor, bool, error) {
+	if m.bits != nil {
+		return m.nextUnframed()
+	}
+
+	if err := m.discard(); err != nil {
+		return nil, false, err
+	}
+
+	size, err := binary.ReadUvarint(m.br)
+	if err == io.EOF {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	m.frame = io.LimitedReader{R: m.r, N: int64(min(size, 1<<62))}
+	m.index++
+	m.cur = nil
+
+	d, err := NewDecompressor(&m.frame)
+	if err != nil {
+		return nil, false, err
+	}
+	m.cur = d
+	return d, true, nil
+}
+
+// As Next, for sets without framing. Decodes the rest of the current
+// set, which ends with padding to a byte, to find the start of the next.
+func (m *MultiDecompressor) nextUnframed() (*Decompressor, bool, error) {
+	if m.cur != nil {
+		buf := GetBuffer()
+		defer PutBuffer(buf)
+		for m.cur.Remaining() > 0 {
+			xs := buf[:min(uint64(len(buf)), m.cur.Remaining())]
+			if err := m.cur.Read(xs); err != nil {
+				return nil, false, err
+			}
+		}
+		m.bits.SkipBits(m.bits.size % 8)
+	}
+
+	if m.bits.NearEOF() {
+		return nil, false, nil
+	}
+
+	m.index++
+	m.cur = nil
+
+	d, err := newDecompressor(m.bits, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	m.cur = d
+	return d, true, nil
+}
+
+// Fills set with the next values of the current frame, advancing to the
+// next frame if there are none left. Returns the number of values read,
+// which all belong to the frame returned by CurrentFrame.
+//
+// Returns io.EOF if there are no frames left.
+func (m *MultiDecompressor) Read(set []uint64) (int, error) {
+	if len(set) == 0 {
+		return 0, nil
+	}
+
+	for m.cur == nil || m.cur.Remaining() == 0 {
+		_, ok, err := m.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, io.EOF
+		}
+		if m.OnFrame != nil {
+			m.OnFrame(m.index)
+		}
+	}
+
+	n := int(min(uint64(len(set)), m.cur.Remaining()))
+	if err := m.cur.Read(set[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Returns the index of the current frame, starting at zero, or -1 before
+// the first frame.
+func (m *MultiDecompressor) CurrentFrame() int {
+	return m.index
+}
+
+// Skips the rest of the current frame, for instance after an error
+// reading it, and remembers it as skipped.
+//
+// A corrupted length prefix can't be recovered from, as it's unclear
+// where the next frame starts. Neither can sets without framing, for
+// which SkipFrame returns an error.
+func (m *MultiDecompressor) SkipFrame() error {
+	if m.index < 0 {
+		return nil
+	}
+	if m.bits != nil {
+		return errSkipUnframed
+	}
+	if len(m.skipped) == 0 || m.skipped[len(m.skipped)-1] != m.index {
+		m.skipped = append(m.skipped, m.index)
+	}
+
+	// Don't let Read continue with the Decompressor of the skipped frame.
+	m.cur = nil
+	return m.discard()
+}
+
+// Returns the indices of the frames passed to SkipFrame, starting at zero.
+func (m *MultiDecompressor) Skipped() []int {
+	return m.skipped
+}
+
+// Reads the rest of the current frame.
+func (m *MultiDecompressor) discard() error {
+	if m.frame.N == 0 {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, &m.frame)
+	if err == nil && m.frame.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Reads single bytes from a reader that might not support it itself.
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(r.r, r.buf[:])
+	return r.buf[0], err
+}
@@ -0,0 +1,343 @@
+package ncrlite
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestFrames(t *testing.T) {
+	sets := [][]uint64{{}, {7}, {1, 2, 3}, sample(100000, 1000)}
+	for _, set := range sets {
+		slices.Sort(set)
+	}
+
+	var buf bytes.Buffer
+	for _, set := range sets {
+		if err := WriteFrame(&buf, set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	xs := buf.Bytes()
+
+	// Also through a reader that isn't an io.ByteReader.
+	for _, r := range []io.Reader{
+		bytes.NewReader(xs),
+		&plainReader{bytes.NewReader(xs)},
+	} {
+		for _, set := range sets {
+			ret, err := ReadFrame(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(set, ret) {
+				t.Fatalf("%v %v", set, ret)
+			}
+		}
+
+		if _, err := ReadFrame(r); err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+
+	// Truncated last frame
+	r := bytes.NewReader(xs[:len(xs)-1])
+	for range sets[:len(sets)-1] {
+		ReadFrame(r)
+	}
+	if _, err := ReadFrame(r); err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+}
+
+func TestSkipFrame(t *testing.T) {
+	sets := [][]uint64{{}, sample(100000, 1000), {5}, sample(1000, 10)}
+	for _, set := range sets {
+		slices.Sort(set)
+	}
+
+	var buf bytes.Buffer
+	for i, set := range sets {
+		if i == 2 {
+			// A corrupt frame: unsupported format flags.
+			buf.Write([]byte{4, 2, 0, 0xff, 0xff})
+		}
+		if err := WriteFrame(&buf, set); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewFramedDecompressor(&plainReader{bytes.NewReader(buf.Bytes())})
+	var got [][]uint64
+	for {
+		d, ok, err := m.Next()
+		if err != nil {
+			if err := m.SkipFrame(); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if !ok {
+			break
+		}
+
+		// Only read part of the large set: Next skips the rest.
+		xs := make([]uint64, min(d.Remaining(), 10))
+		if err := d.Read(xs); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, xs)
+	}
+
+	if len(got) != len(sets) {
+		t.Fatalf("%d %d", len(got), len(sets))
+	}
+	for i, set := range sets {
+		if !slices.Equal(got[i], set[:min(len(set), 10)]) {
+			t.Fatalf("%d: %v %v", i, got[i], set)
+		}
+	}
+	if !slices.Equal(m.Skipped(), []int{2}) {
+		t.Fatal(m.Skipped())
+	}
+}
+
+func TestSkipCorruptPayload(t *testing.T) {
+	large := make([]uint64, 1000)
+	for i := range large {
+		large[i] = uint64(7 * i)
+	}
+	sets := [][]uint64{{1, 2, 3}, large, {5, 8}}
+
+	var buf bytes.Buffer
+	for i, set := range sets {
+		var frame bytes.Buffer
+		if err := WriteFrame(&frame, set); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			// Corrupt the endmarker after the deltas.
+			frame.Bytes()[frame.Len()-1] ^= 0xff
+		}
+		buf.Write(frame.Bytes())
+	}
+
+	m := NewFramedDecompressor(&buf)
+	got := make([][]uint64, len(sets))
+	xs := make([]uint64, 100)
+	for tries := 0; tries < 100; tries++ {
+		n, err := m.Read(xs)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if err := m.SkipFrame(); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		i := m.CurrentFrame()
+		got[i] = append(got[i], xs[:n]...)
+	}
+
+	if !slices.Equal(m.Skipped(), []int{1}) {
+		t.Fatal(m.Skipped())
+	}
+	for _, i := range []int{0, 2} {
+		if !slices.Equal(got[i], sets[i]) {
+			t.Fatalf("%d: %v %v", i, got[i], sets[i])
+		}
+	}
+}
+
+func TestMultiDecompressorRead(t *testing.T) {
+	sets := [][]uint64{{1, 2, 3}, {}, sample(100000, 1000), {5}}
+	for _, set := range sets {
+		slices.Sort(set)
+	}
+
+	var buf bytes.Buffer
+	for _, set := range sets {
+		if err := WriteFrame(&buf, set); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewFramedDecompressor(&buf)
+	if m.CurrentFrame() != -1 {
+		t.Fatal(m.CurrentFrame())
+	}
+
+	var frames []int
+	m.OnFrame = func(index int) {
+		frames = append(frames, index)
+	}
+
+	got := make([][]uint64, len(sets))
+	xs := make([]uint64, 100)
+	for {
+		n, err := m.Read(xs)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		i := m.CurrentFrame()
+		got[i] = append(got[i], xs[:n]...)
+	}
+
+	if !slices.Equal(frames, []int{0, 1, 2, 3}) {
+		t.Fatal(frames)
+	}
+	for i, set := range sets {
+		if !slices.Equal(got[i], set) {
+			t.Fatalf("%d: %v %v", i, got[i], set)
+		}
+	}
+}
+
+func TestMultiDecompressorUnframed(t *testing.T) {
+	dense := make([]uint64, 10000)
+	for i := range dense {
+		dense[i] = uint64(i + i/3)
+	}
+	sets := [][]uint64{
+		{}, {7}, sample(100000, 1000), {}, {}, {1<<64 - 1},
+		{1000, 1001}, dense, {5}, sample(1<<40, 1000), {},
+	}
+	for _, set := range sets {
+		slices.Sort(set)
+	}
+
+	var buf bytes.Buffer
+	for _, set := range sets {
+		if err := CompressSorted(&buf, set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+
+	// Read every other set only partly: Next skips the rest.
+	for _, r := range []io.Reader{
+		bytes.NewReader(data),
+		&plainReader{bytes.NewReader(data)},
+	} {
+		m := NewMultiDecompressor(r)
+		var got [][]uint64
+		for {
+			d, ok, err := m.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+
+			n := d.Remaining()
+			if len(got)%2 == 1 {
+				n = min(n, 10)
+			}
+			xs, err := d.ReadN(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, xs)
+		}
+
+		if len(got) != len(sets) {
+			t.Fatalf("%d %d", len(got), len(sets))
+		}
+		for i, set := range sets {
+			if i%2 == 1 {
+				set = set[:min(len(set), 10)]
+			}
+			if !slices.Equal(got[i], set) {
+				t.Fatalf("%d: %v %v", i, got[i], set)
+			}
+		}
+	}
+
+	m := NewMultiDecompressor(bytes.NewReader(data))
+	got := make([][]uint64, len(sets))
+	xs := make([]uint64, 100)
+	for {
+		n, err := m.Read(xs)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		i := m.CurrentFrame()
+		got[i] = append(got[i], xs[:n]...)
+	}
+	for i, set := range sets {
+		if !slices.Equal(got[i], set) {
+			t.Fatalf("%d: %v %v", i, got[i], set)
+		}
+	}
+	if err := m.SkipFrame(); err != errSkipUnframed {
+		t.Fatal(err)
+	}
+}
+
+// Collects the bytes written to it, and whether it's closed.
+type partWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *partWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestCompressSplit(t *testing.T) {
+	set := sample(1000000, 10000)
+	slices.Sort(set)
+
+	for _, maxBytes := range []int{20, 100, 1000, 1 << 20} {
+		var parts []*partWriter
+		err := CompressSplit(set, maxBytes, func(i int) (io.WriteCloser, error) {
+			if i != len(parts) {
+				t.Fatalf("part %d after %d", i, len(parts))
+			}
+			if len(parts) > 0 && !parts[len(parts)-1].closed {
+				t.Fatalf("part %d not closed", i-1)
+			}
+			parts = append(parts, &partWriter{})
+			return parts[i], nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var all bytes.Buffer
+		for i, part := range parts {
+			if part.Len() > maxBytes {
+				t.Fatalf("part %d: %d > %d", i, part.Len(), maxBytes)
+			}
+			all.Write(part.Bytes())
+		}
+
+		var got []uint64
+		for {
+			xs, err := ReadFrame(&all)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, xs...)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("maxBytes=%d: %d values, want %d", maxBytes, len(got), len(set))
+		}
+	}
+
+	err := CompressSplit(set, 3, func(int) (io.WriteCloser, error) {
+		return &partWriter{}, nil
+	})
+	if err != errPartTooSmall {
+		t.Fatal(err)
+	}
+}
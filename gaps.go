@@ -0,0 +1,105 @@
+package ncrlite
+
+import "io"
+
+// Fills gaps with the differences between the next decompressed values
+// and those before them. The gap of the first value of the set is the
+// value itself.
+//
+// Note that this differs from the deltas of ToDeltas, of which the first
+// is the value plus one, so that the first gap may be zero. The other
+// gaps equal the deltas.
+//
+// If fewer than len(gaps) values remain, returns ErrNoMore without
+// reading any.
+func (d *Decompressor) ReadGaps(gaps []uint64) error {
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+
+	first := d.remaining == d.size
+	prev := d.last
+
+	if err := d.Read(gaps); err != nil {
+		return err
+	}
+
+	fillGaps(gaps, gaps, prev, first)
+	return nil
+}
+
+// Fills values and gaps with the next decompressed values and their gaps,
+// as returned by ReadGaps, until either is full or no values remain.
+// Returns the number of values read.
+func (d *Decompressor) ReadWithGaps(values, gaps []uint64) (int, error) {
+	if err := d.readHeader(); err != nil {
+		return 0, err
+	}
+
+	n := int(min(uint64(min(len(values), len(gaps))), d.remaining))
+	first := d.remaining == d.size
+	prev := d.last
+
+	if err := d.Read(values[:n]); err != nil {
+		return 0, err
+	}
+
+	fillGaps(gaps[:n], values[:n], prev, first)
+	return n, nil
+}
+
+// Sets gaps to the differences between consecutive values, where prev is
+// the value before them, unless they start the set. gaps and values may
+// be the same slice.
+func fillGaps(gaps, values []uint64, prev uint64, first bool) {
+	for i, x := range values {
+		if i > 0 || !first {
+			gaps[i] = x - prev
+		} else {
+			gaps[i] = x
+		}
+		prev = x
+	}
+}
+
+// Merges posting lists given as gaps into a single compressed set.
+type GapMerger struct {
+	b *SetBuilder
+}
+
+// Returns a GapMerger that writes the union of the posting lists
+// to w on Close.
+func NewGapMerger(w io.Writer) *GapMerger {
+	return &GapMerger{b: NewSetBuilder(w)}
+}
+
+// Adds a posting list, given as gaps as returned by ReadGaps: the first
+// value, followed by the differences between consecutive values. Unlike
+// with FromDeltas, the first value isn't offset by one. Values in
+// multiple lists are stored once.
+func (m *GapMerger) AddGaps(gaps []uint64) error {
+	values := make([]uint64, len(gaps))
+	x := uint64(0)
+	for i, g := range gaps {
+		if x+g < x {
+			return ErrOverflow
+		}
+		x += g
+		values[i] = x
+	}
+	return m.b.AddSorted(values)
+}
+
+// Adds the compressed posting list from r.
+func (m *GapMerger) AddCompressed(r io.Reader) error {
+	values, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	return m.b.AddSorted(values)
+}
+
+// Writes the compressed union of all posting lists added.
+func (m *GapMerger) Close() error {
+	return m.b.Close()
+}
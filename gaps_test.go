@@ -0,0 +1,126 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestReadGaps(t *testing.T) {
+	set := sample(100000, 1000)
+	slices.Sort(set)
+
+	var buf bytes.Buffer
+	CompressSorted(&buf, set)
+
+	d, err := NewDecompressor(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read in uneven batches to check gaps carry over between them.
+	gaps := []uint64{}
+	batch := make([]uint64, 7)
+	for d.Remaining() > 0 {
+		n := min(len(batch), int(d.Remaining()))
+		if err := d.ReadGaps(batch[:n]); err != nil {
+			t.Fatal(err)
+		}
+		gaps = append(gaps, batch[:n]...)
+	}
+
+	if gaps[0] != set[0] {
+		t.Fatalf("%d ≠ %d", gaps[0], set[0])
+	}
+	for i := 1; i < len(set); i++ {
+		if gaps[i] != set[i]-set[i-1] {
+			t.Fatalf("%d: %d ≠ %d", i, gaps[i], set[i]-set[i-1])
+		}
+	}
+
+	// Only the first gap differs from the deltas, by one.
+	deltas, err := ToDeltas(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps[0]++
+	if !slices.Equal(gaps, deltas) {
+		t.Fatal("gaps don't match deltas")
+	}
+}
+
+func TestGapMerger(t *testing.T) {
+	a := []uint64{1, 5, 10, 20}
+
+	var bufA, out bytes.Buffer
+	CompressSorted(&bufA, a)
+
+	m := NewGapMerger(&out)
+	if err := m.AddCompressed(&bufA); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddGaps([]uint64{5, 1, 14, 80}); err != nil { // 5, 6, 20, 100
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDecompressor(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps := make([]uint64, d.Remaining())
+	if err := d.ReadGaps(gaps); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uint64{1, 4, 1, 4, 10, 80}
+	if !slices.Equal(gaps, want) {
+		t.Fatalf("%v %v", gaps, want)
+	}
+
+	if NewGapMerger(&out).AddGaps([]uint64{1 << 63, 1 << 63}) != ErrOverflow {
+		t.Fatal("expected overflow")
+	}
+}
+
+func TestReadWithGaps(t *testing.T) {
+	set := sample(100000, 1000)
+	slices.Sort(set)
+
+	var buf bytes.Buffer
+	CompressSorted(&buf, set)
+
+	d, err := NewDecompressor(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make([]uint64, 7)
+	gaps := make([]uint64, 9)
+	i := 0
+	for d.Remaining() > 0 {
+		n, err := d.ReadWithGaps(values, gaps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != min(len(values), len(set)-i) {
+			t.Fatalf("%d %d", n, i)
+		}
+		for j := 0; j < n; j++ {
+			want := set[i]
+			if i > 0 {
+				want -= set[i-1]
+			}
+			if values[j] != set[i] || gaps[j] != want {
+				t.Fatalf("%d: %d %d %d", i, values[j], gaps[j], want)
+			}
+			i++
+		}
+	}
+
+	if n, err := d.ReadWithGaps(values, gaps); n != 0 || err != nil {
+		t.Fatalf("%d %v", n, err)
+	}
+}
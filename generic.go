@@ -0,0 +1,67 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+)
+
+// Unsigned integer types, which can be compressed with CompressSortedT.
+type Unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+var errDoesNotFit = errors.New("Value does not fit in the type")
+
+// Writes a compressed version of set to w, in the same format as
+// CompressSorted does for the values as uint64s.
+//
+// Doesn't copy set to a []uint64: it adds the values to a Compressor,
+// which needs at most a few bytes per value, and spills to a temporary
+// file for large sets.
+//
+// Returns an error if set isn't sorted or has duplicates.
+func CompressSortedT[T Unsigned](w io.Writer, set []T) error {
+	c := NewCompressor(w)
+	for _, x := range set {
+		if err := c.Add(uint64(x)); err != nil {
+			return c.abort(err)
+		}
+	}
+	return c.Close()
+}
+
+// Decompresses a set from r into a slice of T.
+//
+// The returned slice will be sorted. Returns an error if the set contains
+// a value that doesn't fit in T.
+func DecompressT[T Unsigned](r io.Reader) ([]T, error) {
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Remaining() > MaxSetSize {
+		return nil, ErrTooLarge
+	}
+
+	// Don't trust the size for the allocation; see readN.
+	xs := GetBuffer()
+	defer PutBuffer(xs)
+	ret := make([]T, 0, min(d.Remaining(), decompressChunk))
+
+	for d.Remaining() > 0 {
+		toRead := xs[:min(len(xs), int(d.Remaining()))]
+		if err := d.Read(toRead); err != nil {
+			return nil, err
+		}
+
+		for _, x := range toRead {
+			if uint64(T(x)) != x {
+				return nil, errDoesNotFit
+			}
+			ret = append(ret, T(x))
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,64 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func testCompressSortedT[T Unsigned](t *testing.T, set []T) {
+	buf := new(bytes.Buffer)
+	if err := CompressSortedT(buf, set); err != nil {
+		t.Fatal(err)
+	}
+
+	// The format is the same as for the values widened to uint64.
+	set64 := make([]uint64, len(set))
+	for i, x := range set {
+		set64[i] = uint64(x)
+	}
+	buf2 := new(bytes.Buffer)
+	if err := CompressSorted(buf2, set64); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		t.Fatalf("%v %v", buf.Bytes(), buf2.Bytes())
+	}
+
+	got, err := DecompressT[T](buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, set) {
+		t.Fatalf("%v %v", got, set)
+	}
+}
+
+func TestCompressSortedT(t *testing.T) {
+	testCompressSortedT(t, []uint16{})
+	testCompressSortedT(t, []uint16{0xffff})
+	testCompressSortedT(t, []uint16{0, 1, 2, 300, 0xffff})
+	testCompressSortedT(t, []uint32{0, 0xfffffffe, 0xffffffff})
+	testCompressSortedT(t, []uint64{1<<64 - 1})
+	testCompressSortedT(t, []uint64{0, 1<<64 - 2, 1<<64 - 1})
+
+	set := sample(100000, 2000)
+	slices.Sort(set)
+	set32 := make([]uint32, len(set))
+	for i, x := range set {
+		set32[i] = uint32(x)
+	}
+	testCompressSortedT(t, set32)
+	testCompressSortedT(t, set)
+
+	buf := new(bytes.Buffer)
+	if err := CompressSortedT(buf, []uint32{3, 3}); err != errNotSet || buf.Len() != 0 {
+		t.Fatal(err, buf.Len())
+	}
+
+	buf.Reset()
+	CompressSorted(buf, []uint64{1, 1 << 16})
+	if _, err := DecompressT[uint16](buf); err != errDoesNotFit {
+		t.Fatal(err)
+	}
+}
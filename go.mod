@@ -1,9 +1,10 @@
 module github.com/bwesterb/go-ncrlite
 
-go 1.22.5
+go 1.23
 
 require (
-	golang.org/x/sys v0.22.0 // indirect
-	golang.org/x/term v0.22.0 // indirect
-	rsc.io/getopt v0.0.0-20170811000552-20be20937449 // indirect
+	golang.org/x/term v0.22.0
+	rsc.io/getopt v0.0.0-20170811000552-20be20937449
 )
+
+require golang.org/x/sys v0.22.0 // indirect
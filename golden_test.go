@@ -0,0 +1,85 @@
+package ncrlite
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// Compressed files in testdata that the current version has to reproduce
+// exactly, so that the format doesn't change by accident.
+func TestGolden(t *testing.T) {
+	balanced := []uint64{}
+	for i := 0; i < 64; i++ {
+		balanced = append(balanced, uint64(1)<<i)
+	}
+
+	// math/rand guarantees the same values for the same seed.
+	rng := rand.New(rand.NewSource(1))
+	lut := make(map[uint64]struct{})
+	for len(lut) < 1000 {
+		lut[uint64(rng.Intn(100000))] = struct{}{}
+	}
+	random := []uint64{}
+	for x := range lut {
+		random = append(random, x)
+	}
+	slices.Sort(random)
+
+	for _, tc := range []struct {
+		name     string
+		set      []uint64
+		compress func(io.Writer, []uint64) error
+	}{
+		{"empty", []uint64{}, CompressSorted},
+		{"max-uint64", []uint64{0xffffffffffffffff}, CompressSorted},
+		{"one-bitlength", []uint64{0, 1, 2, 3, 4, 5}, CompressSorted},
+		{"unbalanced", []uint64{0xfffffffffffffffd, 0xfffffffffffffffe}, CompressSorted},
+		{"unbalanced-huffman", []uint64{0xfffffffffffffffd, 0xfffffffffffffffe},
+			func(w io.Writer, set []uint64) error {
+				return CompressWithCodebook(w, set, CodeLengths(set))
+			}},
+		{"balanced", balanced, CompressSorted},
+		{"random", random, CompressSorted},
+		{"random-huffman", random, func(w io.Writer, set []uint64) error {
+			return CompressWithCodebook(w, set, CodeLengths(set))
+		}},
+		{"random-offset", random, CompressSortedOffset},
+	} {
+		var buf bytes.Buffer
+		if err := tc.compress(&buf, tc.set); err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join("testdata", tc.name+".ncrlite")
+		if *update {
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("%s: %x ≠ %x", tc.name, buf.Bytes(), want)
+		}
+
+		ret, err := Decompress(bytes.NewReader(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ret, tc.set) {
+			t.Fatalf("%s: %v %v", tc.name, ret, tc.set)
+		}
+	}
+}
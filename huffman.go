@@ -54,6 +54,27 @@ func (h htLut) Print(w io.Writer) {
 	}
 }
 
+// Reads a value encoded with the Huffman code from br. A nil table
+// is the trivial code with only the value zero.
+func (h htLut) ReadValue(br *BitReader) byte {
+	if h == nil {
+		return 0
+	}
+
+	node := 0
+	for {
+		entry := h[node+int(br.PeekByte())]
+
+		if entry.skip != 0 {
+			br.SkipBits(entry.skip)
+			return entry.value
+		}
+
+		br.SkipBits(8)
+		node = entry.next
+	}
+}
+
 func (h htCode) Print(w io.Writer) {
 	for i, entry := range h {
 		fmt.Fprintf(w, "%2d ", i)
@@ -66,10 +87,16 @@ func (h htCode) Print(w io.Writer) {
 	}
 }
 
-// Pack codebook
-func (h htCode) Pack(bw *bitWriter) {
-	bw.WriteBits(uint64(len(h)-1), 6)
-	bw.WriteBits(uint64(h[0].length), 6)
+// Pack codebook using fields of the given width for the largest
+// bitlength and the first codelength, or uvarints if width is zero.
+func (h htCode) Pack(bw *BitWriter, width int) {
+	if width == 0 {
+		bw.WriteUvarint(uint64(len(h) - 1))
+		bw.WriteUvarint(uint64(h[0].length))
+	} else {
+		bw.WriteBits(uint64(len(h)-1), width)
+		bw.WriteBits(uint64(h[0].length), width)
+	}
 
 	prev := h[0].length
 
@@ -90,11 +117,22 @@ func (h htCode) Pack(bw *bitWriter) {
 	}
 }
 
-func unpackCodeLengths(br *bitReader, l io.Writer) ([]byte, error) {
-	size := 12
-	n := br.ReadBits(6) + 1
+// Returns the number of bits of the first two fields of a codebook with
+// n bitlengths and first codelength h0, packed with the given width.
+func headerBits(n uint64, h0 byte, width int) int {
+	if width == 0 {
+		return int(8 * (uvarintLen(n-1) + uvarintLen(uint64(h0))))
+	}
+	return 2 * width
+}
+
+// Unpack codebook of which the first two fields, the number of bitlengths n
+// and the first codelength h0, have already been read with the given width.
+func unpackCodeLengths(br *BitReader, n uint64, h0 byte, width int,
+	l io.Writer) ([]byte, error) {
+	size := headerBits(n, h0, width)
 	h := make([]byte, n)
-	h[0] = byte(br.ReadBits(6))
+	h[0] = h0
 	if l != nil {
 		fmt.Fprintf(l, "max bitlength        %d\n", n-1)
 		fmt.Fprintf(l, "codelength h[0]      %d\n", h[0])
@@ -142,7 +180,44 @@ func unpackCodeLengths(br *bitReader, l io.Writer) ([]byte, error) {
 		}
 	}
 
-	return h, br.Err()
+	if err := br.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := checkCodeLengths(h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Checks whether the codelengths h form a complete prefix code, that is,
+// whether they satisfy the Kraft inequality with equality. The encoder
+// only produces such codes.
+func checkCodeLengths(h []byte) error {
+	// Number of codewords of each length.
+	var counts [65]uint64
+	for _, l := range h {
+		if l == 0 || l > 64 {
+			return errors.New("invalid codelength in Huffman table")
+		}
+		counts[l]++
+	}
+
+	// Pair up the codewords of each length into nodes one level up.
+	// For a complete code, this ends in a single root.
+	for l := 64; l > 0; l-- {
+		if counts[l]%2 != 0 {
+			return errors.New("incomplete or oversubscribed Huffman code")
+		}
+		counts[l-1] += counts[l] / 2
+	}
+
+	if counts[0] != 1 {
+		return errors.New("incomplete or oversubscribed Huffman code")
+	}
+
+	return nil
 }
 
 // Priority queue to find nodes with lowest count
@@ -184,6 +259,8 @@ func buildHuffmanCode(freq []int) htCode {
 		}
 	}
 
+	// The heap starts in order of bitlength, so how ties in count and
+	// depth are broken only depends on freq: the code is deterministic.
 	heap.Init(&h)
 
 	// Build the tree: combine the two subtrees with the shortest count
@@ -232,8 +309,41 @@ func buildHuffmanCode(freq []int) htCode {
 	return codebook
 }
 
-func unpackHuffmanTree(br *bitReader, l io.Writer) (htLut, error) {
-	codeLengths, err := unpackCodeLengths(br, l)
+// Create a code for the given frequency table that minimizes the size of
+// the codebook packed with the given width and the deltas together.
+//
+// The Huffman code minimizes the size of the deltas only. We also try the
+// Huffman codes for the frequencies with a constant added, which bring the
+// codelengths of rare bitlengths closer to those of their neighbours, and
+// so have fewer changes in codelength to pack.
+func buildCompactHuffmanCode(freq []int, width int) htCode {
+	best := buildHuffmanCode(freq)
+	bestBits := best.encodedBits(freq, width)
+
+	total := 0
+	for _, f := range freq {
+		total += f
+	}
+
+	// Once the constant exceeds the total, the frequencies are within
+	// a factor two of each other and the code doesn't change anymore.
+	smoothed := make([]int, len(freq))
+	for c := 1; c <= 2*total; c *= 2 {
+		for i, f := range freq {
+			smoothed[i] = f + c
+		}
+		code := buildHuffmanCode(smoothed)
+		if n := code.encodedBits(freq, width); n < bestBits {
+			best, bestBits = code, n
+		}
+	}
+
+	return best
+}
+
+func unpackHuffmanTree(br *BitReader, n uint64, h0 byte, width int,
+	l io.Writer) (htLut, error) {
+	codeLengths, err := unpackCodeLengths(br, n, h0, width, l)
 	if err != nil {
 		return nil, err
 	}
@@ -286,7 +396,7 @@ func unpackHuffmanTree(br *bitReader, l io.Writer) (htLut, error) {
 	}
 
 	// Build the prefix table
-	lut := make(htLut, 256)
+	lut := make(htLut, 256, lutSize(codebook))
 
 	type todoEntry struct {
 		node   *htNode
@@ -332,6 +442,62 @@ func unpackHuffmanTree(br *bitReader, l io.Writer) (htLut, error) {
 	return lut, nil
 }
 
+// Returns the expected number of bits of a delta, codeword included, if
+// the bitlengths occur with the probabilities implied by the code: 2⁻ˡ
+// for a codeword of length l.
+func (h htLut) expectedBits() float64 {
+	type todoEntry struct {
+		offset int     // in htLut
+		depth  int     // bits read to get to this table
+		weight float64 // probability of getting to this table
+	}
+
+	ret := 0.0
+	todo := []todoEntry{{0, 0, 1}}
+
+	for len(todo) > 0 {
+		cur := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+
+		// A codeword of length l shorter than eight bits has 2⁸⁻ˡ
+		// entries, so each entry is equally likely.
+		weight := cur.weight / 256
+		for code := 0; code < 256; code++ {
+			entry := h[cur.offset+code]
+			if entry.skip == 0 {
+				todo = append(todo, todoEntry{entry.next, cur.depth + 8, weight})
+				continue
+			}
+			bits := cur.depth + int(entry.skip) + int(entry.value)
+			ret += weight * float64(bits)
+		}
+	}
+
+	return ret
+}
+
+// Returns the number of entries in the prefix table for codebook: 256 for
+// each table, of which there is one for the root, and one for each distinct
+// prefix of a multiple of eight bits of the longer codewords.
+func lutSize(codebook htCode) int {
+	tables := 1
+	prefixes := make([]uint64, 0, len(codebook))
+	for depth := 8; depth < 64; depth += 8 {
+		prefixes = prefixes[:0]
+		for _, entry := range codebook {
+			if int(entry.length) > depth {
+				prefixes = append(prefixes, entry.code&(1<<depth-1))
+			}
+		}
+		if len(prefixes) == 0 {
+			break
+		}
+		slices.Sort(prefixes)
+		tables += len(slices.Compact(prefixes))
+	}
+	return 256 * tables
+}
+
 func canonicalHuffmanCode(codeLengths []byte) htCode {
 	type valueLength struct {
 		value  byte
@@ -0,0 +1,62 @@
+package ncrlite
+
+import (
+	"io"
+	"iter"
+)
+
+// Returns an iterator over the remaining values, in order. Decodes them
+// in small batches, so memory use doesn't grow with the size of the set.
+//
+// On error, yields it with a zero value, and stops. If the loop stops
+// early, the rest of the current batch is lost: don't read from d after.
+func (d *Decompressor) All() iter.Seq2[uint64, error] {
+	return func(yield func(uint64, error) bool) {
+		if err := d.readHeader(); err != nil {
+			yield(0, err)
+			return
+		}
+
+		buf := GetBuffer()
+		defer PutBuffer(buf)
+		for d.remaining > 0 {
+			xs := buf[:min(uint64(len(buf)), d.remaining)]
+			if err := d.Read(xs); err != nil {
+				yield(0, err)
+				return
+			}
+
+			for _, x := range xs {
+				if !yield(x, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Writes a compressed version of the values of seq, which must be sorted
+// and without duplicates, to w. Uses a Compressor, so it iterates over seq
+// only once, and spills the deltas to a temporary file instead of holding
+// them in memory. The output is the same as that of CompressSorted.
+func CompressSeq(w io.Writer, seq iter.Seq[uint64]) error {
+	c := NewCompressor(w)
+	for x := range seq {
+		if err := c.Add(x); err != nil {
+			return c.abort(err)
+		}
+	}
+	return c.Close()
+}
+
+// Returns an iterator over the values of the compressed set read from r,
+// in order. See Decompressor.All.
+func Iter(r io.Reader) iter.Seq2[uint64, error] {
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return func(yield func(uint64, error) bool) {
+			yield(0, err)
+		}
+	}
+	return d.All()
+}
@@ -0,0 +1,126 @@
+package ncrlite
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestIter(t *testing.T) {
+	for _, set := range [][]uint64{{}, {5}, {1, 2, 3}, sample(100000, 1000)} {
+		slices.Sort(set)
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, set)
+		xs := buf.Bytes()
+
+		got := []uint64{}
+		for x, err := range Iter(bytes.NewReader(xs)) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, x)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("%v %v", got, set)
+		}
+
+		// Break early.
+		n := 0
+		for range Iter(bytes.NewReader(xs)) {
+			n++
+			if n == 2 {
+				break
+			}
+		}
+		if n != min(2, len(set)) {
+			t.Fatal(n)
+		}
+	}
+
+	// Truncated
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, sample(100000, 1000))
+	var err error
+	for _, err = range Iter(bytes.NewReader(buf.Bytes()[:buf.Len()/2])) {
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCompressSeq(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compresses 10⁸ values")
+	}
+
+	const n = 100000000
+	seq := func(yield func(uint64) bool) {
+		x := uint64(0)
+		for i := uint64(0); i < n; i++ {
+			x += 1 + (i*7919)%13
+			if !yield(x) {
+				return
+			}
+		}
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "ncrlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	w := bufio.NewWriter(f)
+	if err := CompressSeq(w, seq); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Holding the values would take 800MB.
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+		t.Fatalf("allocated %dMB", alloc>>20)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	// Compare with the values of seq, computed along.
+	i, want := uint64(0), uint64(0)
+	for x, err := range Iter(f) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		want += 1 + (i*7919)%13
+		if x != want {
+			t.Fatalf("%d: %d ≠ %d", i, x, want)
+		}
+		i++
+	}
+	if i != n {
+		t.Fatal(i)
+	}
+
+	err = CompressSeq(io.Discard, func(yield func(uint64) bool) {
+		for _, x := range []uint64{5, 3} {
+			if !yield(x) {
+				return
+			}
+		}
+	})
+	if err != errNotSet {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,67 @@
+package ncrlite
+
+import (
+	"io"
+	"slices"
+)
+
+// Writes a compressed version of the multiset set, which may have
+// duplicates, to w. Forgets about the order.
+//
+// Modifies set, as it sorts it in place. The distinct values are stored
+// as the keys of CompressColumns, with the number of repeats of each as
+// its value, which is cheap if there are few.
+func CompressMultiset(w io.Writer, set []uint64) error {
+	slices.Sort(set)
+	keys, repeats := countRepeats(set)
+	return CompressColumns(w, keys, repeats)
+}
+
+// Decompresses a multiset written by CompressMultiset from r.
+//
+// The returned slice will be sorted, with every value repeated as often
+// as it was in the multiset.
+func DecompressMultiset(r io.Reader) ([]uint64, error) {
+	keys, repeats, err := DecompressColumns(r)
+	if err != nil {
+		return nil, err
+	}
+	return expandRepeats(keys, repeats)
+}
+
+// Returns the distinct values of the sorted multiset set, and for each
+// the number of times it's repeated after its first occurrence.
+func countRepeats(set []uint64) ([]uint64, []uint64) {
+	var keys, repeats []uint64
+	for i, x := range set {
+		if i > 0 && x == set[i-1] {
+			repeats[len(repeats)-1]++
+			continue
+		}
+		keys = append(keys, x)
+		repeats = append(repeats, 0)
+	}
+	return keys, repeats
+}
+
+// Returns the sorted multiset with the given distinct values and repeats,
+// the inverse of countRepeats.
+func expandRepeats(keys, repeats []uint64) ([]uint64, error) {
+	// Check the size before allocating, as the repeats might be huge.
+	size := uint64(len(keys))
+	for _, n := range repeats {
+		size += n
+		if size < n || size > MaxSetSize {
+			return nil, ErrTooLarge
+		}
+	}
+
+	ret := make([]uint64, 0, size)
+	for i, x := range keys {
+		for j := uint64(0); j <= repeats[i]; j++ {
+			ret = append(ret, x)
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,48 @@
+package ncrlite
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestMultiset(t *testing.T) {
+	large := make([]uint64, 10000)
+	for i := range large {
+		large[i] = uint64(rand.Intn(3000))
+	}
+
+	for _, set := range [][]uint64{
+		{},
+		{7},
+		{7, 7},
+		{1, 1, 1, 5, 5, 9},
+		{0, 0, 1<<64 - 1, 1<<64 - 1},
+		large,
+	} {
+		want := slices.Clone(set)
+		slices.Sort(want)
+
+		buf := new(bytes.Buffer)
+		if err := CompressMultiset(buf, set); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := DecompressMultiset(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("%v %v", got, want)
+		}
+	}
+}
+
+func TestDecompressMultisetTooLarge(t *testing.T) {
+	buf := new(bytes.Buffer)
+	CompressColumns(buf, []uint64{1, 2}, []uint64{1<<64 - 1, 1})
+	if _, err := DecompressMultiset(buf); err != ErrTooLarge {
+		t.Fatal(err)
+	}
+}
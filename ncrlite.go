@@ -1,88 +1,380 @@
 package ncrlite
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc64"
 	"io"
+	"math"
 	"math/bits"
 	"slices"
 )
 
 // Writes a compressed version of set to w.
 //
-// Assumes no duplicates in set. Forgets about the order.
+// Returns an error if set has duplicates. Forgets about the order.
 func Compress(w io.Writer, set []uint64) error {
 	slices.Sort(set)
 	return CompressSorted(w, set)
 }
 
+// Writes a compressed version of set to w, skipping duplicates. Returns
+// the number of duplicates skipped.
+//
+// Modifies set, as it sorts and compacts it in place.
+func CompressDedup(w io.Writer, set []uint64) (int, error) {
+	slices.Sort(set)
+	unique := slices.Compact(set)
+	return len(set) - len(unique), CompressSorted(w, unique)
+}
+
 // Writes a compressed version of set to w.
 //
-// Assumes set is sorted and has no duplictes.
+// The output is deterministic: the same set is always compressed to the
+// same bytes, regardless of platform.
+//
+// Returns an error if set isn't sorted or has duplicates.
 func CompressSorted(w io.Writer, set []uint64) error {
-	bw := newBitWriter(w)
+	return compressSorted(w, set, 0, nil)
+}
 
-	bw.WriteUvarint(uint64(len(set)))
+// Options for compression.
+type CompressOptions struct {
+	// If set, doesn't write the endmarker at the end, which saves a byte.
+	// The stream can then only be read with the NoEndMarker or the
+	// AllowMissingEndMarker option set.
+	//
+	// Without endmarker, there is less protection against a truncated
+	// or corrupted stream.
+	OmitEndMarker bool
+
+	// If set, called with the number of bytes written to w so far,
+	// whenever a buffered chunk of the output is written out. Use it
+	// to report progress on huge sets.
+	Progress func(bytesWritten int64)
+
+	// If set, uses these codelengths for the Huffman code of the
+	// bitlengths of the deltas, instead of deriving them from the set.
+	// See CompressWithCodebook.
+	CodeLengths []byte
+
+	// If set, also considers Huffman codes that give rare bitlengths
+	// a codelength closer to that of their neighbours, and picks the one
+	// with the smallest codebook and deltas together. That shrinks the
+	// codebook at a small cost per delta, which pays off for small sets.
+	CompactCodebook bool
+
+	// If positive, writes an index after the set with a checkpoint every
+	// SampleEvery values, with which RandomAccess finds the value of
+	// a given rank by decoding at most SampleEvery values.
+	//
+	// A checkpoint takes two uvarints: the number of bits and the
+	// difference in value since the previous one. That's typically four
+	// to eight bytes, so with SampleEvery 64, the index adds about a tenth
+	// of a byte per value.
+	SampleEvery int
 
-	if err := bw.Err(); err != nil {
+	// If set, writes a footer after the set, which describes it and can
+	// be read with ReadFooter without decoding the set.
+	Footer bool
+}
+
+// Writes a compressed version of set to bw, starting at its current bit
+// offset, without closing bw. More bits can be written after it.
+//
+// Returns an error, before writing anything, if set isn't sorted or has
+// duplicates.
+func CompressSortedTo(bw *BitWriter, set []uint64) error {
+	if err := writeSet(bw, set, 0, nil); err != nil {
 		return err
 	}
+	return bw.Err()
+}
 
-	if len(set) == 0 {
-		return bw.Close()
-	}
+// Writes a compressed version of set to w, storing the deltas from its
+// minimum, which saves space for sets of large values in a narrow range.
+//
+// Assumes set is sorted and has no duplicates.
+func CompressSortedOffset(w io.Writer, set []uint64) error {
+	return compressSorted(w, set, flagOffset, nil)
+}
 
-	if len(set) == 1 {
-		bw.WriteUvarint(set[0])
-		return bw.Close()
+// Writes a compressed version of set to w with the given options.
+// opts may be nil.
+//
+// Assumes set is sorted and has no duplicates.
+func CompressSortedWithOptions(w io.Writer, set []uint64,
+	opts *CompressOptions) error {
+	return compressSorted(w, set, 0, opts)
+}
+
+// Writes a compressed version of the values returned by next to w, such
+// as those of a database cursor. next returns the values in increasing
+// order, and false once there are none left.
+//
+// Like CompressSeq, it uses a Compressor, so the values aren't held in
+// memory. As the codebook depends on all values and precedes them,
+// nothing is written before the cursor is exhausted.
+//
+// Returns the error of next, if any, and an error as soon as a value
+// isn't larger than the one before. Then nothing is written.
+func CompressCursor(w io.Writer, next func() (uint64, bool, error)) error {
+	c := NewCompressor(w)
+	for {
+		x, ok, err := next()
+		if err != nil {
+			return c.abort(err)
+		}
+		if !ok {
+			break
+		}
+		if err := c.Add(x); err != nil {
+			return c.abort(err)
+		}
 	}
 
-	// Compute deltas
-	ds := make([]uint64, len(set))
+	return c.Close()
+}
 
-	// None of the other deltas can be zero, so add one. As set contains
-	// at least two element, set[0] can't be 2⁶⁴-1, so there is no overflow.
-	ds[0] = set[0] + 1
-	for i := 0; i < len(ds)-1; i++ {
-		if set[i+1] <= set[i] {
-			panic("set has duplicates or is not sorted")
+// Returns the number of bytes CompressSorted would write for set.
+//
+// Computes it from the Huffman code for the bitlengths of the deltas,
+// without encoding them. Returns an error if set isn't sorted or has
+// duplicates.
+func CompressedLen(set []uint64) (int64, error) {
+	n := uint64(len(set))
+	bits := 8 * uvarintLen(n)
+
+	switch {
+	case n == 1:
+		bits += 8 * uvarintLen(set[0])
+	case n >= 2:
+		ds, err := toDeltas(set, 0)
+		if err != nil {
+			return 0, err
 		}
+		bits += deltaBits(ds, 0) + 8 // and the endmarker
+	}
 
-		ds[i+1] = set[i+1] - set[i]
+	return int64((bits + 7) / 8), nil
+}
+
+// Flags that can be set in the extended header.
+const (
+	// Reserved. Narrower codebook fields for values below 2³² save at
+	// most two bits, which doesn't make up for the extended header.
+	_ byte = 1 << iota
+
+	// The extended header is followed by an offset as uvarint, which is
+	// subtracted from the values before computing the deltas.
+	flagOffset
+
+	// Instead of the codebook, there is a Rice parameter k in six bits,
+	// and the deltas minus one are Rice coded with it: the quotient by 2ᵏ
+	// in unary, and then the remainder in k bits.
+	flagRice
+
+	// The first two fields of the codebook, the largest bitlength and
+	// the first codelength, are uvarints instead of fixed width, so that
+	// they can describe bitlengths of values wider than 64 bits. As we
+	// only support uint64s, we read this variant with at most 64
+	// bitlengths, but don't write it.
+	flagWide
+
+	knownFlags = flagOffset | flagRice | flagWide
+)
+
+// Returns the width of the fields in the packed codebook, which is zero
+// if they're uvarints.
+func codebookWidth(flags byte) int {
+	if flags&flagWide != 0 {
+		return 0
 	}
+	return 6
+}
 
-	// Compute bitlength counts of deltas
-	freq := []int{}
-	for i := 0; i < len(ds); i++ {
-		bn := bits.Len64(ds[i]) - 1
-		for bn >= len(freq) {
-			freq = append(freq, 0)
+// Writes a compressed version of set to w in the format variant
+// described by flags.
+func compressSorted(w io.Writer, set []uint64, flags byte,
+	opts *CompressOptions) error {
+	if opts != nil && opts.Progress != nil {
+		w = &countingWriter{w: w, progress: opts.Progress}
+	}
+
+	bw := NewBitWriter(w)
+	if err := writeSet(bw, set, flags, opts); err != nil {
+		return err
+	}
+	return bw.Close()
+}
+
+// Writes a compressed version of set to bw in the format variant
+// described by flags, without closing bw. opts may be nil.
+//
+// Returns an error, before writing anything, if set isn't sorted or
+// has duplicates, or if opts has CodeLengths that can't be used for it.
+func writeSet(bw *BitWriter, set []uint64, flags byte,
+	opts *CompressOptions) error {
+	if opts == nil {
+		opts = &CompressOptions{}
+	}
+
+	if len(set) <= 1 {
+		bw.WriteUvarint(uint64(len(set)))
+		if len(set) == 1 {
+			bw.WriteUvarint(set[0])
+		}
+		if opts.SampleEvery > 0 {
+			writeIndex(bw, uint64(opts.SampleEvery), nil)
 		}
-		freq[bn]++
+		if opts.Footer {
+			// Such a set is written without extended header.
+			writeFooter(bw, set, 0)
+		}
+		return nil
 	}
 
-	// Compute Huffman code for the bitlengths
-	code := buildHuffmanCode(freq)
+	var offset uint64
+	if flags&flagOffset != 0 {
+		offset = set[0]
+	}
 
-	// Pack Huffman code
-	code.Pack(bw)
-	if err := bw.Err(); err != nil {
+	ds, err := toDeltas(set, offset)
+	if err != nil {
 		return err
 	}
 
-	// Pack each delta
-	for _, d := range ds {
-		bn := bits.Len64(d) - 1
+	freq := bitLengthFreqs(ds)
+	if opts.CodeLengths != nil {
+		if err := checkCodebook(opts.CodeLengths, len(freq)); err != nil {
+			return err
+		}
+	}
 
-		bw.WriteBits(uint64(code[bn].code), int(code[bn].length))
+	start := bw.bitsWritten()
+	bw.WriteUvarint(uint64(len(set)))
+
+	// Compute the Huffman code for the bitlengths of the deltas, unless
+	// it's given, and check whether Rice coding is smaller.
+	var (
+		code htCode
+		k    uint8
+	)
+	if opts.CodeLengths != nil {
+		code = canonicalHuffmanCode(opts.CodeLengths)
+	} else {
+		if opts.CompactCodebook {
+			code = buildCompactHuffmanCode(freq, codebookWidth(flags))
+		} else {
+			code = buildHuffmanCode(freq)
+		}
+
+		var rice bool
+		k, rice = preferRice(ds, freq, code, flags)
+		if rice {
+			flags |= flagRice
+		}
+	}
+
+	// A variant of the format is signalled by an extended header: a
+	// codebook with only the zero bitlength, but a non-zero codelength
+	// for it. That cannot occur otherwise. Instead of the codelength,
+	// we store the flags, and then the actual codebook follows.
+	if flags != 0 {
+		bw.WriteBits(0, 6)
+		bw.WriteBits(uint64(flags), 6)
+	}
+
+	if flags&flagOffset != 0 {
+		bw.WriteUvarint(offset)
+	}
+
+	if flags&flagRice != 0 {
+		bw.WriteBits(uint64(k), 6)
+	} else {
+		code.Pack(bw, codebookWidth(flags))
+	}
+
+	// Write the deltas in chunks, recording a checkpoint before each but
+	// the first, if we're asked for an index.
+	every := len(ds)
+	if opts.SampleEvery > 0 {
+		every = opts.SampleEvery
+	}
+	var checkpoints []checkpoint
+	for i := 0; i < len(ds); i += every {
+		if i > 0 {
+			checkpoints = append(checkpoints, checkpoint{
+				pos:  bw.bitsWritten() - start,
+				prev: set[i-1],
+			})
+		}
 
-		bw.WriteBits(d^(1<<bn), bn)
+		chunk := ds[i:min(len(ds), i+every)]
+		if flags&flagRice != 0 {
+			writeRice(bw, chunk, k)
+		} else {
+			for _, d := range chunk {
+				writeDelta(bw, code, d)
+			}
+		}
 	}
 
 	// End with single byte so that when reading we can
 	// peek efficiently without hitting EOF.
-	bw.WriteBits(0xaa, 8)
+	if !opts.OmitEndMarker {
+		bw.WriteBits(EndMarker, 8)
+	}
 
-	return bw.Close()
+	if opts.SampleEvery > 0 {
+		writeIndex(bw, uint64(every), checkpoints)
+	}
+
+	if opts.Footer {
+		writeFooter(bw, set, flags)
+	}
+
+	return nil
+}
+
+// Writes the codebook and the deltas ds, which must be non-zero, to bw.
+// If lengths is not nil, uses it as codelengths instead of deriving them.
+func writeDeltas(bw *BitWriter, ds []uint64, flags byte, lengths []byte) {
+	code := writeCodebook(bw, ds, flags, lengths)
+
+	// Pack each delta
+	for _, d := range ds {
+		writeDelta(bw, code, d)
+	}
+}
+
+// Computes the Huffman code for the bitlengths of the deltas ds, unless
+// the codelengths are given, and writes it to bw in the format variant
+// described by flags.
+func writeCodebook(bw *BitWriter, ds []uint64, flags byte,
+	lengths []byte) htCode {
+	var code htCode
+	if lengths != nil {
+		code = canonicalHuffmanCode(lengths)
+	} else {
+		// Compute Huffman code for the bitlength counts of deltas
+		code = buildHuffmanCode(bitLengthFreqs(ds))
+	}
+
+	// Pack Huffman code
+	code.Pack(bw, codebookWidth(flags))
+
+	return code
+}
+
+// Writes the non-zero delta d to bw using code.
+func writeDelta(bw *BitWriter, code htCode, d uint64) {
+	bn := bits.Len64(d) - 1
+
+	bw.WriteBits(uint64(code[bn].code), int(code[bn].length))
+
+	bw.WriteBits(d^(1<<bn), bn)
 }
 
 // Decompresses a set of uint64s from r.
@@ -93,40 +385,234 @@ func Decompress(r io.Reader) ([]uint64, error) {
 	if err != nil {
 		return nil, err
 	}
-	ret := make([]uint64, d.Remaining())
-	err = d.Read(ret)
-	if err != nil {
+
+	return d.readN(d.Remaining())
+}
+
+// Reads the next count values into a new slice.
+func (d *Decompressor) readN(count uint64) ([]uint64, error) {
+	if count > MaxSetSize {
+		return nil, ErrTooLarge
+	}
+
+	// The size is not to be trusted: a corrupted stream could claim
+	// to contain many more values than it does. Thus we grow the
+	// returned slice as we go instead of allocating it upfront.
+	ret := make([]uint64, 0, min(count, decompressChunk))
+	for uint64(len(ret)) < count {
+		n := int(min(count-uint64(len(ret)), uint64(max(len(ret), decompressChunk))))
+		ret = slices.Grow(ret, n)
+		err := d.Read(ret[len(ret) : len(ret)+n])
+		if err != nil {
+			return nil, err
+		}
+		ret = ret[:len(ret)+n]
+	}
+	return ret, nil
+}
+
+// Decompresses the remaining values, and returns those for which keep
+// returns true given their index in the set, which starts at zero.
+//
+// Still decodes all values, as their positions are only known by decoding
+// those before, but doesn't store those that aren't kept.
+func (d *Decompressor) ReadFiltered(keep func(index uint64) bool) (
+	[]uint64, error) {
+	if err := d.readHeader(); err != nil {
 		return nil, err
 	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+
+	ret := []uint64{}
+	for d.remaining > 0 {
+		index := d.size - d.remaining
+		xs := buf[:min(uint64(len(buf)), d.remaining)]
+		if err := d.Read(xs); err != nil {
+			return nil, err
+		}
+
+		for i, x := range xs {
+			if keep(index + uint64(i)) {
+				ret = append(ret, x)
+			}
+		}
+	}
+
 	return ret, nil
 }
 
+// Number of values Decompress reads before growing the returned slice.
+const decompressChunk = 1 << 16
+
+// Returned by Decompress when the set is too large to fit in memory,
+// or larger than the MaxSize option.
+var ErrTooLarge = errors.New("Set too large")
+
+// Limits of the format and of this implementation.
+const (
+	// Eight bits written after the values of a compressed set, unless
+	// the OmitEndMarker option was used. They're not aligned to a byte.
+	// The format has no magic bytes at the start.
+	EndMarker = 0xaa
+
+	// Largest value that can be stored. The format stores the values
+	// as uint64.
+	MaxValue = math.MaxUint64
+
+	// Largest number of values Decompress returns. A compressed set can
+	// claim up to 2⁶⁴-1 values, but a larger set wouldn't fit in memory,
+	// and is rejected with ErrTooLarge. A Decompressor reads such sets
+	// fine, in parts.
+	MaxSetSize = math.MaxInt / 8
+)
+
 type Decompressor struct {
-	br        *bitReader
+	br        *BitReader
 	size      uint64
 	remaining uint64
 	l         io.Writer
 
+	flags   byte   // flags from the extended header, if any
+	offset  uint64 // offset, if flagOffset is set
+	riceK   byte   // Rice parameter, if flagRice is set
+	nbl     int    // number of bitlengths in the Huffman code
 	tree    htLut  // Huffman tree
-	prev    uint64 // last value emitted
-	started bool   // true if a value has been emitted
+	prev    uint64 // last value decoded
+	started bool   // true if a value has been decoded
+	peeked  bool   // true if next holds a decoded value not yet returned
+	next    uint64 // value decoded ahead by ReadUntil
+	last    uint64 // last value returned
+
+	checksum bool   // true if we keep a checksum of the values emitted
+	crc      uint64 // CRC-64 of values emitted so far
+
+	noEndMarker bool // true if the stream has no endmarker
+	lenient     bool // true if the endmarker may be missing
+
+	err error // error that stopped Channel, if any
+
+	lazy      io.Reader // if set, the header is yet to be read from it
+	headerErr error     // error reading the header lazily, if any
+
+	footer *Footer // footer read before the set, if any
+}
+
+// Options for a Decompressor.
+type DecompressOptions struct {
+	// If set, logs information about the compressed format to Log.
+	Log io.Writer
+
+	// If set, keeps a running checksum of the values decompressed,
+	// which can be retrieved with Checksum().
+	Checksum bool
+
+	// Set to read a stream written with the OmitEndMarker option.
+	NoEndMarker bool
+
+	// If set, accepts a stream both with and without the endmarker: one
+	// that ends right where the endmarker would be is taken to be written
+	// with the OmitEndMarker option. Then a stream truncated exactly at
+	// the endmarker isn't detected.
+	AllowMissingEndMarker bool
+
+	// If non-zero, returns ErrTooLarge for sets with more values, before
+	// decoding any. Use it to bound the memory used on untrusted input.
+	MaxSize uint64
+}
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// Returns the CRC-64 (ECMA) of the values decompressed so far, each
+// encoded as eight little-endian bytes.
+//
+// Only available if the Decompressor was created with the Checksum option.
+// Otherwise returns zero.
+func (d *Decompressor) Checksum() uint64 {
+	return d.crc
+}
+
+// Adds the values in set to the running checksum.
+func (d *Decompressor) updateChecksum(set []uint64) {
+	var buf [8 * 64]byte
+	for len(set) > 0 {
+		n := min(len(set), 64)
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint64(buf[8*i:], set[i])
+		}
+		d.crc = crc64.Update(d.crc, crcTable, buf[:8*n])
+		set = set[n:]
+	}
 }
 
-// Returns the number of uint64 remaining to be decompressed.
+// Returns the number of uint64 remaining to be decompressed. This is zero
+// for the empty set right after NewDecompressor.
 func (d *Decompressor) Remaining() uint64 {
+	d.readHeader()
 	return d.remaining
 }
 
 var ErrNoMore = errors.New("Reading beyond end of set")
 
+// Returns the number of bitlengths in the Huffman code: one more than the
+// largest bitlength of the deltas. Not every bitlength below it has to
+// occur. Returns zero for sets with fewer than two elements and Rice
+// coded sets, which don't have a Huffman code.
+func (d *Decompressor) NumBitLengths() int {
+	d.readHeader()
+	return d.nbl
+}
+
+// Returns the offset subtracted from the values before computing their
+// deltas, as written by CompressSortedOffset. The first delta is thus the
+// smallest value minus the offset plus one. Returns zero for other sets.
+func (d *Decompressor) Offset() uint64 {
+	d.readHeader()
+	return d.offset
+}
+
+// Returns an estimate of the work to decode the remaining values, without
+// decoding any: the number of remaining values times one plus the expected
+// number of bits of their deltas. That is derived from the code in the
+// header, assuming each bitlength occurs with the probability implied by
+// the length of its codeword, or for Rice coding, from the parameter.
+//
+// Use it to compare sets, for instance to schedule the cheapest first.
+func (d *Decompressor) EstimatedDecodeCost() uint64 {
+	if d.readHeader() != nil {
+		return 0
+	}
+
+	var bits float64
+	switch {
+	case d.size <= 1:
+	case d.flags&flagRice != 0:
+		// The remainder, and a unary quotient of one on average.
+		bits = float64(d.riceK) + 2
+	case d.tree != nil:
+		bits = d.tree.expectedBits()
+	}
+
+	cost := float64(d.remaining) * (1 + bits)
+	if cost >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(cost)
+}
+
 // Return the total number of bytes read so far.
 func (d *Decompressor) BytesRead() int {
+	d.readHeader()
 	return d.br.total
 }
 
+// Returned when the values in a corrupted stream exceed 2⁶⁴-1.
+var ErrOverflow = errors.New("Value overflows uint64")
+
 // Do the actual reading after having accounted for all error conditions
 // and corner cases.
-func (d *Decompressor) read(set []uint64) {
+func (d *Decompressor) read(set []uint64) error {
 	for i := 0; i < len(set); i++ {
 		// Read codeword for length
 		node := 0
@@ -155,45 +641,204 @@ func (d *Decompressor) read(set []uint64) {
 			d.started = true
 		}
 
+		// The first value is compared to the offset, if any.
+		if val < d.prev {
+			return ErrOverflow
+		}
+
 		d.prev = val
 		set[i] = val
 	}
+
+	return nil
+}
+
+// As read, for the Huffman code for two bitlengths, which has the codeword
+// 0 for bitlength 0 and 1 for bitlength 1. So a delta of 1 is stored as
+// 0, and a delta of 2 or 3 as 1 followed by its lowest bit, which we
+// decode from the buffered bits directly, without branches.
+func (d *Decompressor) readTwoBitLengths(set []uint64) error {
+	br := d.br
+
+	for i := 0; i < len(set); i++ {
+		var delta uint64
+
+		if br.size >= 2 {
+			long := br.buf & 1
+			delta = 1 + long + (long & (br.buf >> 1))
+			br.buf >>= 1 + long
+			br.size -= 1 + byte(long)
+		} else if br.PeekByte()&1 == 0 {
+			delta = 1
+			br.SkipBits(1)
+		} else {
+			delta = 2 | uint64(br.PeekByte()>>1)&1
+			br.SkipBits(2)
+		}
+
+		val := d.prev + delta
+
+		if !d.started {
+			val-- // we shifted the first value so it can't be zero as delta
+			d.started = true
+		}
+
+		if val < d.prev {
+			return ErrOverflow
+		}
+
+		d.prev = val
+		set[i] = val
+	}
+
+	return nil
 }
 
 // Fill set with decompressed uint64s.
+//
+// If fewer than len(set) values remain, returns ErrNoMore without
+// reading any. Reading into an empty set is a no-op, even at the end of
+// the stream: check Remaining to see whether any values are left.
+// If the underlying reader returns an error, such as a
+// timeout, the Decompressor can't continue and returns that error from
+// then on.
 func (d *Decompressor) Read(set []uint64) error {
 	if len(set) == 0 {
 		return nil
 	}
 
-	if d.size == 0 {
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+
+	if d.remaining < uint64(len(set)) {
 		return ErrNoMore
 	}
 
-	if d.size == 1 {
-		if d.remaining == 0 {
-			return ErrNoMore
+	n := 0
+	if d.peeked {
+		set[0] = d.next
+		d.peeked = false
+		d.remaining--
+		n = 1
+	}
+
+	if err := d.decode(set[n:]); err != nil {
+		return err
+	}
+
+	d.remaining -= uint64(len(set) - n)
+	d.last = set[len(set)-1]
+
+	if d.checksum {
+		d.updateChecksum(set)
+	}
+
+	return nil
+}
+
+// Returns the next n decompressed uint64s, or all that remain if there
+// are fewer. The Decompressor stays usable: later calls continue after
+// them, without parsing the header again.
+//
+// As with Decompress, returns ErrTooLarge if that's more than MaxSetSize.
+func (d *Decompressor) ReadN(n uint64) ([]uint64, error) {
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d.readN(min(n, d.remaining))
+}
+
+// Fills set with decompressed uint64s until either set is full or the
+// next value would exceed max. Returns the number of values written to set.
+//
+// The first value exceeding max is not consumed: it is returned by the
+// next call to Read or ReadUntil.
+func (d *Decompressor) ReadUntil(max uint64, set []uint64) (n int, err error) {
+	if err := d.readHeader(); err != nil {
+		return 0, err
+	}
+
+	for n < len(set) && d.remaining > 0 {
+		if !d.peeked {
+			if err := d.decode(set[n : n+1]); err != nil {
+				return n, err
+			}
+			d.next = set[n]
+			d.peeked = true
 		}
 
-		set[0] = d.br.ReadUvarint()
-		if err := d.br.Err(); err != nil {
-			return err
+		if d.next > max {
+			break
+		}
+
+		set[n] = d.next
+		d.last = d.next
+		d.peeked = false
+		d.remaining--
+		n++
+	}
+
+	if d.checksum {
+		d.updateChecksum(set[:n])
+	}
+
+	return n, nil
+}
+
+// Skips values until the first one that is at least x, and returns it,
+// positioning d right after it. Returns false, after consuming all values,
+// if there is none. Doesn't allocate.
+//
+// A linear scan from the current position: values that were already read
+// are not considered.
+func (d *Decompressor) SeekGE(x uint64) (uint64, bool, error) {
+	if err := d.readHeader(); err != nil {
+		return 0, false, err
+	}
+
+	var buf [1]uint64
+	for d.remaining > 0 {
+		if d.peeked {
+			buf[0] = d.next
+			d.peeked = false
+		} else if err := d.decode(buf[:]); err != nil {
+			return 0, false, err
 		}
 
-		d.remaining = 0
+		d.remaining--
+		d.last = buf[0]
+		if d.checksum {
+			d.updateChecksum(buf[:])
+		}
 
-		if len(set) > 1 {
-			return ErrNoMore
+		if buf[0] >= x {
+			return buf[0], true, nil
 		}
+	}
+
+	return 0, false, nil
+}
 
+// Decodes the next len(set) values from the stream into set, and checks
+// the endmarker after the last one. Does not update remaining.
+func (d *Decompressor) decode(set []uint64) error {
+	if len(set) == 0 {
 		return nil
 	}
 
-	if d.remaining < uint64(len(set)) {
-		return ErrNoMore
+	undecoded := d.remaining
+	if d.peeked {
+		undecoded--
 	}
 
-	if d.tree == nil {
+	if d.size == 1 {
+		set[0] = d.br.ReadUvarint()
+	} else if d.flags&flagRice != 0 {
+		if err := d.readRice(set); err != nil {
+			return err
+		}
+	} else if d.tree == nil {
 		for i := 0; i < len(set); i++ {
 			val := d.prev + 1
 
@@ -202,17 +847,27 @@ func (d *Decompressor) Read(set []uint64) error {
 				d.started = true
 			}
 
+			if val < d.prev {
+				return ErrOverflow
+			}
+
 			d.prev = val
 			set[i] = val
 		}
-	} else {
-		d.read(set)
+	} else if d.nbl == 2 {
+		if err := d.readTwoBitLengths(set); err != nil {
+			return err
+		}
+	} else if err := d.read(set); err != nil {
+		return err
 	}
 
-	d.remaining -= uint64(len(set))
+	if undecoded == uint64(len(set)) && !d.noEndMarker && d.size != 1 {
+		// A stream written with OmitEndMarker ends with at most seven
+		// zero bits of padding instead.
+		missing := d.lenient && d.br.PeekByte() == 0 && d.br.NearEOF()
 
-	if d.remaining == 0 {
-		if d.br.ReadBits(8) != 0xaa {
+		if !missing && d.br.ReadBits(8) != EndMarker {
 			return errors.New("Incorrect endmarker")
 		}
 	}
@@ -220,23 +875,167 @@ func (d *Decompressor) Read(set []uint64) error {
 	return d.br.Err()
 }
 
+// Returns the number of values in the compressed set from r, by only
+// reading its size at the start of the stream.
+func Count(r io.Reader) (uint64, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+
+	var ret uint64
+	for s := 0; ; s += 7 {
+		b, err := br.ReadByte()
+		if err == io.EOF && s > 0 {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+
+		if s == 63 && b > 1 {
+			return 0, ErrUvarintOverflow
+		}
+
+		ret |= uint64(b&0x7f) << s
+
+		if b < 0x80 {
+			return ret, nil
+		}
+	}
+}
+
+// Returns whether x is in the compressed set read from r. Stops decoding
+// at the first value that is at least x.
+//
+// This takes time linear in the rank of x, so it's meant for occasional
+// lookups. For many lookups in the same set, decompress it, or compress
+// it with the SampleEvery option and use RandomAccess.
+func Contains(r io.Reader, x uint64) (bool, error) {
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return false, err
+	}
+	y, ok, err := d.SeekGE(x)
+	return ok && y == x, err
+}
+
+// Reads the header of a compressed set from r, without decoding any
+// values, and returns the size of the set.
+//
+// For sets with more than one element, the header includes the codebook,
+// which is checked to be a valid Huffman code.
+func ValidateHeader(r io.Reader) (size uint64, err error) {
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return 0, err
+	}
+	return d.size, nil
+}
+
 // Returns a new Decompressor that reads a set of uint64s from r incrementally.
+//
+// The Decompressor reads ahead from r, possibly past the end of the set.
+// To read a set from within a larger file, such as a member of an archive,
+// pass an io.SectionReader for its byte range.
 func NewDecompressor(r io.Reader) (*Decompressor, error) {
-	return NewDecompressorWithLogging(r, nil)
+	return NewDecompressorWithOptions(r, nil)
 }
 
 // Returns a new Decompressor that reads a set of uint64s from r incrementally.
 //
 // Logs information about the compressed format to l.
 func NewDecompressorWithLogging(r io.Reader, l io.Writer) (*Decompressor, error) {
-	br := newBitReader(r)
-	d := &Decompressor{br: br}
+	return NewDecompressorWithOptions(r, &DecompressOptions{Log: l})
+}
+
+// Returns a new Decompressor that reads a set of uint64s from r incrementally
+// with the given options. opts may be nil.
+//
+// If r is an io.ReadSeeker, reads the footer of the set first, if it has
+// one, which is then returned by Footer.
+func NewDecompressorWithOptions(r io.Reader, opts *DecompressOptions) (
+	*Decompressor, error) {
+	var f *Footer
+	if rs, ok := r.(io.ReadSeeker); ok {
+		f, _ = ReadFooter(rs)
+	}
+
+	d, err := newDecompressor(NewBitReader(r), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// r might contain more than the set, and the footer at its end might
+	// be that of another set, so we check it matches the header.
+	if f != nil && f.Count == d.size && f.Flags == d.flags {
+		d.footer = f
+	}
+	return d, nil
+}
+
+// Returns the footer of the set, if it's written with the Footer option
+// and was read by NewDecompressor from an io.ReadSeeker, and nil otherwise.
+func (d *Decompressor) Footer() *Footer {
+	return d.footer
+}
+
+// Returns a new Decompressor that reads a set of uint64s from br, as
+// written by CompressSortedTo. Once all values are read, br is positioned
+// right after the set.
+func NewDecompressorFromBits(br *BitReader) (*Decompressor, error) {
+	return newDecompressor(br, nil)
+}
+
+// Returns a new Decompressor that reads a set of uint64s from r, but
+// only reads the header once it's used. An error reading the header is
+// returned by every method that returns an error.
+func NewLazyDecompressor(r io.Reader) *Decompressor {
+	return &Decompressor{lazy: r}
+}
+
+// Reads the header, if the Decompressor was created by NewLazyDecompressor
+// and hasn't done so yet. Returns the error reading the header, if any.
+func (d *Decompressor) readHeader() error {
+	if d.lazy == nil {
+		return d.headerErr
+	}
+
+	br := NewBitReader(d.lazy)
+	nd, err := newDecompressor(br, nil)
+	if err != nil {
+		*d = Decompressor{br: br, headerErr: err}
+		return err
+	}
+
+	*d = *nd
+	return nil
+}
+
+// Returns a new Decompressor that reads a set of uint64s from br.
+// opts may be nil.
+func newDecompressor(br *BitReader, opts *DecompressOptions) (
+	*Decompressor, error) {
+	if opts == nil {
+		opts = &DecompressOptions{}
+	}
+
+	l := opts.Log
+	d := &Decompressor{
+		br:          br,
+		l:           l,
+		checksum:    opts.Checksum,
+		noEndMarker: opts.NoEndMarker,
+		lenient:     opts.AllowMissingEndMarker,
+	}
 
 	// Read size of set
 	d.size = br.ReadUvarint()
 	if err := br.Err(); err != nil {
 		return nil, err
 	}
+	if opts.MaxSize != 0 && d.size > opts.MaxSize {
+		return nil, ErrTooLarge
+	}
 
 	d.remaining = d.size
 
@@ -244,12 +1043,89 @@ func NewDecompressorWithLogging(r io.Reader, l io.Writer) (*Decompressor, error)
 		return d, nil
 	}
 
+	// Read the first fields of the codebook, which might signal
+	// an extended header instead.
+	width := 6
+	n := br.ReadBits(6) + 1
+	h0 := byte(br.ReadBits(6))
+
+	if n == 1 && h0 != 0 {
+		d.flags = h0
+		if d.flags&^knownFlags != 0 {
+			return nil, errors.New("Unsupported format flags")
+		}
+
+		if l != nil {
+			fmt.Fprintf(l, "format flags         %06b\n", d.flags)
+		}
+
+		if d.flags&flagOffset != 0 {
+			d.offset = br.ReadUvarint()
+			d.prev = d.offset
+
+			if l != nil {
+				fmt.Fprintf(l, "offset               %d\n", d.offset)
+			}
+		}
+
+		if d.flags&flagRice != 0 {
+			d.riceK = byte(br.ReadBits(6))
+
+			if l != nil {
+				fmt.Fprintf(l, "rice parameter       %d\n", d.riceK)
+			}
+
+			return d, br.Err()
+		}
+
+		width = codebookWidth(d.flags)
+		if width == 0 {
+			n = br.ReadUvarint() + 1
+			wideH0 := br.ReadUvarint()
+
+			// The format allows for any number of bitlengths, but
+			// deltas of uint64s have at most 64.
+			if n > 64 || wideH0 > 64 {
+				return nil, errors.New("Unsupported bitlength in codebook")
+			}
+			h0 = byte(wideH0)
+		} else {
+			n = br.ReadBits(byte(width)) + 1
+			h0 = byte(br.ReadBits(byte(width)))
+		}
+	}
+
+	d.nbl = int(n)
+
 	// Read Huffman code
 	var err error
-	d.tree, err = unpackHuffmanTree(br, l)
+	d.tree, err = unpackHuffmanTree(br, n, h0, width, l)
 	if err != nil {
 		return nil, err
 	}
 
 	return d, nil
 }
+
+// Writes a compressed version of set to w.
+//
+// Returns an error if set has duplicates. Forgets about the order.
+//
+// The output is the same as that of Compress for the values as uint64s.
+// Read it with Decompress32, or Decompress.
+func Compress32(w io.Writer, set []uint32) error {
+	set64 := make([]uint64, len(set))
+	for i, x := range set {
+		set64[i] = uint64(x)
+	}
+	slices.Sort(set64)
+	return CompressSorted(w, set64)
+}
+
+// Decompresses a set of uint32s from r.
+//
+// The returned slice will be sorted. Returns an error if the set contains
+// a value that doesn't fit in 32 bits.
+func Decompress32(r io.Reader) ([]uint32, error) {
+	return DecompressT[uint32](r)
+}
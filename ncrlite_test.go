@@ -1,8 +1,16 @@
 package ncrlite
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
 	"math/rand"
+	"os"
 	"slices"
 	"testing"
 )
@@ -28,6 +36,78 @@ func BenchmarkDecompress(b *testing.B) {
 	}
 }
 
+// Like BenchmarkDecompress, but through a reader of which the stream
+// isn't known to be in memory.
+func BenchmarkDecompressReader(b *testing.B) {
+	b.StopTimer()
+
+	N := 735000000
+	k := 13000000
+
+	buf := new(bytes.Buffer)
+	ret := sample(N, k)
+	Compress(buf, ret)
+	xs := buf.Bytes()
+
+	b.SetBytes(int64(k * 8))
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		Decompress(&plainReader{bytes.NewReader(xs)})
+	}
+}
+
+// Decompresses sets with the given percentage of the values below 10⁷,
+// from dense sets to those of which the bitmap is about as small.
+func BenchmarkDecompressDense(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, pct := range []int{99, 90, 50} {
+		b.Run(fmt.Sprintf("pct=%d", pct), func(b *testing.B) {
+			var set []uint64
+			for x := uint64(0); x < 10000000; x++ {
+				if rng.Intn(100) < pct {
+					set = append(set, x)
+				}
+			}
+
+			var buf bytes.Buffer
+			CompressSorted(&buf, set)
+			xs := buf.Bytes()
+
+			b.SetBytes(int64(len(set) * 8))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				Decompress(bytes.NewReader(xs))
+			}
+		})
+	}
+}
+
+// Decompresses a set of which the deltas are 1, 2 or 3, which has a
+// Huffman code for two bitlengths.
+func BenchmarkDecompressTwoBitLengths(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	set := make([]uint64, 10000000)
+	x := uint64(0)
+	for i := range set {
+		set[i] = x
+		x += 1 + uint64(rng.Intn(3))
+	}
+
+	var buf bytes.Buffer
+	CompressSorted(&buf, set)
+	xs := buf.Bytes()
+
+	b.SetBytes(int64(len(set) * 8))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		Decompress(bytes.NewReader(xs))
+	}
+}
+
 func BenchmarkCompress(b *testing.B) {
 	b.StopTimer()
 
@@ -47,6 +127,171 @@ func BenchmarkCompress(b *testing.B) {
 	}
 }
 
+// Encodes the deltas of set as plain uvarints, without Huffman code.
+func appendVarintDeltas(buf []byte, set []uint64) []byte {
+	prev := uint64(0)
+	for _, x := range set {
+		buf = binary.AppendUvarint(buf, x-prev)
+		prev = x
+	}
+	return buf
+}
+
+// Encodes and decodes the set of BenchmarkCompress as uvarint deltas,
+// as a baseline for ncrlite. Reports the sizes of both.
+func BenchmarkVarintBaseline(b *testing.B) {
+	N := 735000000
+	k := 13000000
+
+	set := sample(N, k)
+	slices.Sort(set)
+	xs := appendVarintDeltas(nil, set)
+
+	var buf bytes.Buffer
+	CompressSorted(&buf, set)
+
+	b.Run("encode", func(b *testing.B) {
+		b.SetBytes(int64(k * 8))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			appendVarintDeltas(xs[:0], set)
+		}
+
+		b.ReportMetric(float64(len(xs))/float64(k), "bytes/value")
+		b.ReportMetric(float64(buf.Len())/float64(k), "ncrlite-bytes/value")
+	})
+
+	b.Run("decode", func(b *testing.B) {
+		ret := make([]uint64, k)
+		b.SetBytes(int64(k * 8))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			prev := uint64(0)
+			ys := xs
+			for j := range ret {
+				d, n := binary.Uvarint(ys)
+				ys = ys[n:]
+				prev += d
+				ret[j] = prev
+			}
+		}
+	})
+}
+
+// Compresses into a bufio.Writer of various sizes over io.Discard. As
+// NewBitWriter reuses a large enough bufio.Writer, this sets the size of
+// the buffer that the BitWriter flushes into.
+func BenchmarkCompressBuffered(b *testing.B) {
+	N := 735000000
+	k := 13000000
+	ret := sample(N, k)
+
+	for _, size := range []int{4096, 1 << 16, 1 << 20} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			w := bufio.NewWriterSize(io.Discard, size)
+			b.SetBytes(int64(k * 8))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				Compress(w, ret)
+			}
+		})
+	}
+}
+
+// Compresses into a temporary file.
+func BenchmarkCompressFile(b *testing.B) {
+	N := 735000000
+	k := 13000000
+	ret := sample(N, k)
+
+	f, err := os.CreateTemp(b.TempDir(), "ncrlite")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	b.SetBytes(int64(k * 8))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if err := Compress(f, ret); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Reports the compressed size of small sets, to keep track of the
+// overhead of the header.
+func BenchmarkCompressSmall(b *testing.B) {
+	for _, k := range []int{1, 2, 4, 8, 9, 16, 32, 64} {
+		b.Run(fmt.Sprintf("k=%d", k), func(b *testing.B) {
+			// Fixed seed for comparable sizes between runs.
+			rng := rand.New(rand.NewSource(int64(k)))
+			lut := make(map[uint64]struct{})
+			for len(lut) < k {
+				lut[uint64(rng.Intn(1<<16))] = struct{}{}
+			}
+			set := []uint64{}
+			for x := range lut {
+				set = append(set, x)
+			}
+			slices.Sort(set)
+
+			buf := new(bytes.Buffer)
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				CompressSorted(buf, set)
+			}
+
+			b.ReportMetric(float64(buf.Len()), "bytes")
+			b.ReportMetric(float64(buf.Len())/float64(k), "bytes/value")
+		})
+	}
+}
+
+// Reports the compressed size of small sets with and without the
+// CompactCodebook option. The gaps are drawn from a heavy-tailed
+// distribution, so that there are many rare bitlengths.
+func BenchmarkCompactCodebook(b *testing.B) {
+	for _, k := range []int{16, 64, 256, 1024, 1 << 16} {
+		b.Run(fmt.Sprintf("k=%d", k), func(b *testing.B) {
+			set := heavyTailedSet(k)
+			opts := &CompressOptions{CompactCodebook: true}
+
+			var plain bytes.Buffer
+			CompressSorted(&plain, set)
+
+			buf := new(bytes.Buffer)
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				CompressSortedWithOptions(buf, set, opts)
+			}
+
+			b.ReportMetric(float64(plain.Len()), "bytes")
+			b.ReportMetric(float64(buf.Len()), "compact-bytes")
+		})
+	}
+}
+
+// Returns a sorted set of k values of which the gaps have a bitlength
+// drawn roughly uniformly from 1 to 40. The seed is fixed.
+func heavyTailedSet(k int) []uint64 {
+	rng := rand.New(rand.NewSource(int64(k)))
+	set := make([]uint64, k)
+	x := uint64(0)
+	for i := range set {
+		x += 1 + uint64(rng.Int63n(1<<uint(rng.Intn(40))))
+		set[i] = x
+	}
+	return set
+}
+
 func sample(N, k int) []uint64 {
 	lut := make(map[uint64]struct{})
 	for len(lut) < k {
@@ -77,6 +322,82 @@ func TestEmpty(t *testing.T) {
 	}
 }
 
+func TestReadEmptySlice(t *testing.T) {
+	for _, set := range [][]uint64{{}, {5}, {1, 2, 3}} {
+		buf := new(bytes.Buffer)
+		Compress(buf, set)
+		d, err := NewDecompressor(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		noop := func() {
+			if err := d.Read(nil); err != nil {
+				t.Fatalf("%v %v", set, err)
+			}
+			if err := d.Read([]uint64{}); err != nil {
+				t.Fatalf("%v %v", set, err)
+			}
+			if err := d.ReadGaps(nil); err != nil {
+				t.Fatalf("%v %v", set, err)
+			}
+			if n, err := d.ReadWithGaps(nil, nil); n != 0 || err != nil {
+				t.Fatalf("%v %d %v", set, n, err)
+			}
+			if n, err := d.ReadUntil(0, nil); n != 0 || err != nil {
+				t.Fatalf("%v %d %v", set, n, err)
+			}
+		}
+
+		var got []uint64
+		noop()
+		for d.Remaining() > 0 {
+			var x [1]uint64
+			if err := d.Read(x[:]); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, x[0])
+			noop()
+		}
+
+		if !slices.Equal(set, got) {
+			t.Fatalf("%v %v", set, got)
+		}
+		if err := d.Read(make([]uint64, 1)); err != ErrNoMore {
+			t.Fatalf("%v %v", set, err)
+		}
+		noop()
+	}
+}
+
+func TestCompressDedup(t *testing.T) {
+	for _, tc := range []struct {
+		set, want []uint64
+		dups      int
+	}{
+		{[]uint64{}, []uint64{}, 0},
+		{[]uint64{3, 1, 2}, []uint64{1, 2, 3}, 0},
+		{[]uint64{5, 5, 5}, []uint64{5}, 2},
+		{[]uint64{4, 1, 4, 0, 1, 9}, []uint64{0, 1, 4, 9}, 2},
+	} {
+		buf := new(bytes.Buffer)
+		dups, err := CompressDedup(buf, slices.Clone(tc.set))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dups != tc.dups {
+			t.Fatalf("%v: %d", tc.set, dups)
+		}
+		got, err := Decompress(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Fatalf("%v %v", got, tc.want)
+		}
+	}
+}
+
 func TestMaxUint64(t *testing.T) {
 	buf := new(bytes.Buffer)
 	ret := []uint64{0xffffffffffffffff}
@@ -103,6 +424,59 @@ func TestLargeUnbalancedCode(t *testing.T) {
 	}
 }
 
+func TestMaxBitLength(t *testing.T) {
+	// Only a few deltas can have the largest bitlength of 64: the first,
+	// which is the smallest value plus one, and one more.
+	sets := [][]uint64{
+		{1<<63 - 1, 1<<64 - 1},
+		{0, 1 << 63, 1<<64 - 1},
+		{1 << 63, 1<<63 + 1, 1<<64 - 2, 1<<64 - 1},
+		{0, 1<<62 + 5, 1<<63 + 7, 3<<62 + 9, 1<<64 - 1},
+	}
+
+	// Write them at every bit offset, so that the 63-bit remainders of
+	// the deltas straddle the 64-bit buffers in every way, both with
+	// the Huffman code and with the coding CompressSortedTo picks.
+	for offset := 0; offset < 64; offset++ {
+		for _, huffman := range []bool{false, true} {
+			buf := new(bytes.Buffer)
+			w := NewBitWriter(buf)
+			w.WriteBits(0, offset)
+			for _, set := range sets {
+				if huffman {
+					err := writeSet(w, set, 0, &CompressOptions{
+						CodeLengths: CodeLengths(set),
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+				} else if err := CompressSortedTo(w, set); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r := NewBitReader(buf)
+			r.SkipBits(byte(offset))
+			for _, set := range sets {
+				d, err := NewDecompressorFromBits(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]uint64, d.Remaining())
+				if err := d.Read(got); err != nil {
+					t.Fatalf("%d %v: %v", offset, set, err)
+				}
+				if !slices.Equal(got, set) {
+					t.Fatalf("%d %v %v", offset, got, set)
+				}
+			}
+		}
+	}
+}
+
 func TestLargeBalancedCode(t *testing.T) {
 	buf := new(bytes.Buffer)
 	ret := []uint64{}
@@ -153,3 +527,1271 @@ func TestJustOneBitlength(t *testing.T) {
 		t.Fatalf("%v %v", ret, ret2)
 	}
 }
+
+func TestCompress32(t *testing.T) {
+	for _, ret := range [][]uint32{
+		{},
+		{0xffffffff},
+		{0, 0xffffffff},
+		{0xfffffffd, 0xfffffffe},
+		{0, 1, 2, 3, 4, 5},
+	} {
+		buf := new(bytes.Buffer)
+		err := Compress32(buf, ret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xs := buf.Bytes()
+
+		ret2, err := Decompress32(bytes.NewReader(xs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ret, ret2) {
+			t.Fatalf("%v %v", ret, ret2)
+		}
+
+		ret3, err := Decompress(bytes.NewReader(xs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range ret {
+			if uint64(ret[i]) != ret3[i] {
+				t.Fatalf("%v %v", ret, ret3)
+			}
+		}
+	}
+
+	ret := make([]uint32, 10000)
+	for i := range ret {
+		ret[i] = rand.Uint32()
+	}
+	slices.Sort(ret)
+	ret = slices.Compact(ret)
+
+	buf := new(bytes.Buffer)
+	Compress32(buf, ret)
+	ret2, err := Decompress32(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ret, ret2) {
+		t.Fatalf("%v %v", ret, ret2)
+	}
+}
+
+func TestCompress32Size(t *testing.T) {
+	for _, k := range []int{2, 3, 10, 100, 10000} {
+		set := sample(1<<32, k)
+		slices.Sort(set)
+		set32 := make([]uint32, k)
+		for i, x := range set {
+			set32[i] = uint32(x)
+		}
+
+		buf := new(bytes.Buffer)
+		Compress32(buf, set32)
+		buf64 := new(bytes.Buffer)
+		CompressSorted(buf64, set)
+		if !bytes.Equal(buf.Bytes(), buf64.Bytes()) {
+			t.Fatalf("%d: %x ≠ %x", k, buf.Bytes(), buf64.Bytes())
+		}
+	}
+}
+
+func TestDecompress32TooLarge(t *testing.T) {
+	buf := new(bytes.Buffer)
+	Compress(buf, []uint64{1, 1 << 32})
+	_, err := Decompress32(buf)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// The flag of the narrow variant, which was never smaller, is reserved.
+func TestReservedFlag(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := compressSorted(buf, []uint64{1, 5, 9}, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decompress(buf); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	ret := sample(100000, 1000)
+	slices.Sort(ret)
+
+	var buf bytes.Buffer
+	Compress(&buf, ret)
+
+	d, err := NewDecompressorWithOptions(&buf, &DecompressOptions{Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read in uneven batches to check the checksum doesn't depend on them.
+	xs := make([]uint64, 7)
+	for d.Remaining() > 0 {
+		n := min(len(xs), int(d.Remaining()))
+		if err := d.Read(xs[:n]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := uint64(0)
+	for _, x := range ret {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], x)
+		want = crc64.Update(want, crc64.MakeTable(crc64.ECMA), b[:])
+	}
+
+	if d.Checksum() != want {
+		t.Fatalf("%x ≠ %x", d.Checksum(), want)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	for _, k := range []int{0, 1, 2, 1000} {
+		ret := sample(100000, k)
+		slices.Sort(ret)
+
+		var buf bytes.Buffer
+		Compress(&buf, ret)
+		xs := buf.Bytes()
+
+		ret2 := []uint64{}
+		var cursor []byte
+
+		for len(ret2) < k {
+			var (
+				d   *Decompressor
+				err error
+			)
+
+			r := bytes.NewReader(xs)
+			if cursor == nil {
+				d, err = NewDecompressor(r)
+			} else {
+				d, err = RestoreDecompressor(r, cursor)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			batch := make([]uint64, min(int(d.Remaining()), 33))
+			if err := d.Read(batch); err != nil {
+				t.Fatal(err)
+			}
+			ret2 = append(ret2, batch...)
+
+			cursor, err = d.SaveCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !slices.Equal(ret, ret2) {
+			t.Fatalf("%v %v", ret, ret2)
+		}
+	}
+}
+
+// Returns a stream that claims size values, but is truncated right after
+// the codebook.
+func lyingSize(size uint64) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	w := NewBitWriter(buf)
+	w.WriteUvarint(size)
+	buildHuffmanCode([]int{1, 1}).Pack(w, 6)
+	w.Close()
+	return buf
+}
+
+func TestDecompressLyingSize(t *testing.T) {
+	_, err := Decompress(lyingSize(1 << 59))
+	if err == nil || err == ErrTooLarge {
+		t.Fatal(err)
+	}
+
+	// Claims 2⁶³ elements, which we can't hold in memory.
+	_, err = Decompress(lyingSize(1 << 63))
+	if err != ErrTooLarge {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	set := []uint64{1, 2, 3, 4}
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+	xs := buf.Bytes()
+
+	for _, max := range []uint64{0, 3, 4, 5} {
+		d, err := NewDecompressorWithOptions(bytes.NewReader(xs),
+			&DecompressOptions{MaxSize: max})
+		if max == 3 {
+			if err != ErrTooLarge {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Remaining() != 4 {
+			t.Fatal(d.Remaining())
+		}
+	}
+
+	// Claims 2⁶³ elements, which we can't hold in memory.
+	buf.Reset()
+	w := NewBitWriter(buf)
+	w.WriteUvarint(1 << 63)
+	buildHuffmanCode([]int{1, 1}).Pack(w, 6)
+	w.Close()
+	if _, err := Decompress32(buf); err != ErrTooLarge {
+		t.Fatal(err)
+	}
+}
+
+func TestReadBeyondSingleton(t *testing.T) {
+	buf := new(bytes.Buffer)
+	Compress(buf, []uint64{42})
+
+	d, err := NewDecompressor(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xs := make([]uint64, 4)
+	if err := d.Read(xs); err != ErrNoMore {
+		t.Fatal(err)
+	}
+
+	// Nothing should have been consumed.
+	if d.Remaining() != 1 {
+		t.Fatal(d.Remaining())
+	}
+
+	if err := d.Read(xs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if xs[0] != 42 || d.Remaining() != 0 {
+		t.Fatalf("%d %d", xs[0], d.Remaining())
+	}
+
+	if err := d.Read(xs[:1]); err != ErrNoMore {
+		t.Fatal(err)
+	}
+}
+
+// Returns a stream with the given deltas, which need not correspond to
+// a valid set.
+func craftStream(ds []uint64) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	bw := NewBitWriter(buf)
+	bw.WriteUvarint(uint64(len(ds)))
+	writeDeltas(bw, ds, 0, nil)
+	bw.WriteBits(0xaa, 8)
+	bw.Close()
+	return buf
+}
+
+func TestOverflow(t *testing.T) {
+	_, err := Decompress(craftStream([]uint64{3 << 62, 1 << 63}))
+	if err != ErrOverflow {
+		t.Fatal(err)
+	}
+
+	_, err = Decompress(craftStream([]uint64{1 << 63, 1 << 63}))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestString(t *testing.T) {
+	ret := []uint64{5, 15, 35, 150, 500, 1500}
+	s, err := CompressSortedString(ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret2, err := DecompressString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ret, ret2) {
+		t.Fatalf("%v %v", ret, ret2)
+	}
+
+	_, err = DecompressString("not base64!")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestOmitEndMarker(t *testing.T) {
+	for _, k := range []int{0, 1, 2, 3, 10, 1000} {
+		for _, N := range []int{k, 2 * k, 1000000} {
+			ret := sample(N, k)
+			slices.Sort(ret)
+
+			buf := new(bytes.Buffer)
+			CompressSorted(buf, ret)
+			size := buf.Len()
+
+			buf.Reset()
+			err := CompressSortedWithOptions(buf, ret,
+				&CompressOptions{OmitEndMarker: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k >= 2 && buf.Len() != size-1 {
+				t.Fatalf("%d %d", buf.Len(), size)
+			}
+
+			d, err := NewDecompressorWithOptions(buf,
+				&DecompressOptions{NoEndMarker: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ret2 := make([]uint64, d.Remaining())
+			if err := d.Read(ret2); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ret, ret2) {
+				t.Fatalf("%v %v", ret, ret2)
+			}
+
+			// Without the option, a missing endmarker is an error,
+			// unless we allow it.
+			buf.Reset()
+			CompressSortedWithOptions(buf, ret,
+				&CompressOptions{OmitEndMarker: true})
+			xs := buf.Bytes()
+			_, err = Decompress(bytes.NewReader(xs))
+			if k >= 2 && err == nil {
+				t.Fatal("expected error")
+			}
+
+			d, err = NewDecompressorWithOptions(bytes.NewReader(xs),
+				&DecompressOptions{AllowMissingEndMarker: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ret2 = make([]uint64, d.Remaining())
+			if err := d.Read(ret2); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ret, ret2) {
+				t.Fatalf("%v %v", ret, ret2)
+			}
+		}
+	}
+}
+
+func TestCompressedLen(t *testing.T) {
+	sets := [][]uint64{
+		{1<<64 - 1},
+		{0, 1<<64 - 1},
+		{1000, 1001},
+		{0, 1, 2, 3, 4, 5, 6, 7, 1007},
+	}
+	for _, k := range []int{0, 1, 2, 3, 10, 1000, 100000} {
+		for _, N := range []int{k + 10, 1000000, 1 << 40} {
+			ret := sample(N, k)
+			slices.Sort(ret)
+			sets = append(sets, ret)
+		}
+	}
+
+	for _, ret := range sets {
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, ret)
+
+		n, err := CompressedLen(ret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Fatalf("%d: %d ≠ %d", len(ret), n, buf.Len())
+		}
+	}
+
+	if _, err := CompressedLen([]uint64{3, 2}); err != errNotSet {
+		t.Fatal(err)
+	}
+}
+
+func TestNumBitLengths(t *testing.T) {
+	for _, tc := range []struct {
+		set []uint64
+		nbl int
+	}{
+		{[]uint64{}, 0},
+		{[]uint64{7}, 0},
+		{[]uint64{0, 1, 2, 3}, 1},
+		{[]uint64{0, 1, 3, 7}, 3},
+		{[]uint64{0, 1, 2, 3, 4, 5, 6, 7, 1007}, 10},
+		{[]uint64{1000, 1001}, 0}, // Rice coded
+	} {
+		buf := new(bytes.Buffer)
+		Compress(buf, tc.set)
+		d, err := NewDecompressor(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.NumBitLengths() != tc.nbl {
+			t.Fatalf("%v: %d ≠ %d", tc.set, d.NumBitLengths(), tc.nbl)
+		}
+	}
+}
+
+func TestReadUntil(t *testing.T) {
+	sets := [][]uint64{{}, {5}, {0, 1, 2, 3, 4, 5, 6, 7}}
+	for _, k := range []int{2, 1000} {
+		ret := sample(100000, k)
+		slices.Sort(ret)
+		sets = append(sets, ret)
+	}
+
+	for _, set := range sets {
+		var buf bytes.Buffer
+		CompressSorted(&buf, set)
+
+		want := uint64(0)
+		for _, x := range set {
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], x)
+			want = crc64.Update(want, crc64.MakeTable(crc64.ECMA), b[:])
+		}
+
+		for _, step := range []uint64{1, 3, 5000} {
+			d, err := NewDecompressorWithOptions(
+				bytes.NewReader(buf.Bytes()),
+				&DecompressOptions{Checksum: true},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ret2 := []uint64{}
+			batch := make([]uint64, 17)
+			for max := uint64(0); max < 100000 && d.Remaining() > 0; max += step {
+				for {
+					n, err := d.ReadUntil(max, batch)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, x := range batch[:n] {
+						if x > max {
+							t.Fatalf("%d > %d", x, max)
+						}
+					}
+					ret2 = append(ret2, batch[:n]...)
+					if n < len(batch) {
+						break
+					}
+				}
+			}
+
+			// Read whatever is left, including a value read ahead.
+			rest := make([]uint64, d.Remaining())
+			if err := d.Read(rest); err != nil {
+				t.Fatal(err)
+			}
+			ret2 = append(ret2, rest...)
+
+			if !slices.Equal(set, ret2) {
+				t.Fatalf("%v %v", set, ret2)
+			}
+			if d.Checksum() != want {
+				t.Fatalf("%x ≠ %x", d.Checksum(), want)
+			}
+		}
+	}
+}
+
+func TestValidateHeader(t *testing.T) {
+	for _, set := range [][]uint64{{}, {3}, {1, 2, 3}, sample(100000, 1000)} {
+		var buf bytes.Buffer
+		Compress(&buf, set)
+		size, err := ValidateHeader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != uint64(len(set)) {
+			t.Fatalf("%d ≠ %d", size, len(set))
+		}
+	}
+
+	// Codelengths 1 and 2 do not form a complete code.
+	buf := new(bytes.Buffer)
+	bw := NewBitWriter(buf)
+	bw.WriteUvarint(2)
+	bw.WriteBits(1, 6) // two bitlengths
+	bw.WriteBits(1, 6) // first codelength
+	bw.WriteBits(0, 1) // change ...
+	bw.WriteBits(1, 1) // ... up
+	bw.WriteBits(1, 1) // next codelength
+	bw.Close()
+	xs := buf.Bytes()
+
+	if _, err := ValidateHeader(bytes.NewReader(xs)); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := Decompress(bytes.NewReader(xs)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	set := sample(1000000, 100000)
+	slices.Sort(set)
+
+	var (
+		buf   bytes.Buffer
+		calls []int64
+	)
+	err := CompressSortedWithOptions(&buf, set, &CompressOptions{
+		Progress: func(n int64) { calls = append(calls, n) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) < 2 || !slices.IsSorted(calls) {
+		t.Fatalf("%v", calls)
+	}
+	if calls[len(calls)-1] != int64(buf.Len()) {
+		t.Fatalf("%d ≠ %d", calls[len(calls)-1], buf.Len())
+	}
+}
+
+// Checks that the output doesn't change between runs, or across
+// platforms and versions: a change would break reproducible builds
+// of compressed files.
+func TestDeterministic(t *testing.T) {
+	var cubes, ties []uint64
+
+	for i := uint64(0); i < 100; i++ {
+		cubes = append(cubes, i*i*i+i%7)
+	}
+	cubes = append(cubes, 1<<40, 1<<63)
+
+	// Every bitlength occurs equally often, so the Huffman code has
+	// to break many ties.
+	x := uint64(0)
+	for r := 0; r < 2; r++ {
+		for j := 0; j < 20; j++ {
+			x += 1 << j
+			ties = append(ties, x)
+		}
+	}
+
+	for _, tc := range []struct {
+		set  []uint64
+		want string
+	}{
+		{cubes, "66fe51550d00c9c9ccaaaaeaa6e97feeec00405535f7d3e9d31900bedefef0" +
+			"a1cb5cfee6eefc513dda0371988ee3b19e0e8367a48dccc1bc04ac1d7bceb2b5" +
+			"f0ad9eabf0821e1ee41a314c68147445741163509af6c6d8f17cf9a0605125a9" +
+			"ce3485ca5275b1da5c89b0585939ede216974bdeb5789c008c0168c10441ad00" +
+			"6ce040f825cc15548ce086d043188224a19e9855fc2d9518208dfa46b303f565" +
+			"0874167c242433c4419450945fc46e247e7c8d749d64ad84bdd4cd54de04efac" +
+			"fff4103522a5334545155715690d7ba58dbfc431f1ffff1f00000000c0ffffaf0a"},
+		{ties, "285341e7dfec7400260b0804181080021800072000b001200140010007007001" +
+			"001a00c00300e003006080c90202010604a00006c00108006c0048005000c001" +
+			"005c00800600f00000f800005005"},
+	} {
+		var buf, buf2 bytes.Buffer
+		CompressSorted(&buf, tc.set)
+		CompressSorted(&buf2, tc.set)
+
+		if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+			t.Fatalf("%x %x", buf.Bytes(), buf2.Bytes())
+		}
+
+		if got := fmt.Sprintf("%x", buf.Bytes()); got != tc.want {
+			t.Fatalf("%s ≠ %s", got, tc.want)
+		}
+	}
+}
+
+func TestCompressSortedOffset(t *testing.T) {
+	for _, base := range []uint64{0, 1000000000, 1<<64 - 200000} {
+		for _, set := range [][]uint64{
+			{},
+			{5},
+			{3, 4, 5, 6},
+			sample(100000, 1000),
+		} {
+			set = slices.Clone(set)
+			slices.Sort(set)
+			for i := range set {
+				set[i] += base
+			}
+
+			var buf bytes.Buffer
+			if err := CompressSortedOffset(&buf, set); err != nil {
+				t.Fatal(err)
+			}
+			ret, err := Decompress(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(set, ret) {
+				t.Fatalf("%v %v", set, ret)
+			}
+		}
+	}
+
+	set := []uint64{1000000000, 1000000001, 1000000003}
+	var buf, buf2 bytes.Buffer
+	CompressSortedOffset(&buf, set)
+	CompressSorted(&buf2, set)
+	if buf.Len() >= buf2.Len() {
+		t.Fatalf("%d ≥ %d", buf.Len(), buf2.Len())
+	}
+
+	d, err := NewDecompressor(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Offset() != set[0] {
+		t.Fatal(d.Offset())
+	}
+	d, err = NewDecompressor(&buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Offset() != 0 {
+		t.Fatal(d.Offset())
+	}
+
+	// The offset plus all ones deltas overflows.
+	buf.Reset()
+	bw := NewBitWriter(&buf)
+	bw.WriteUvarint(3)
+	bw.WriteBits(0, 6)
+	bw.WriteBits(uint64(flagOffset), 6)
+	bw.WriteUvarint(1<<64 - 2)
+	writeDeltas(bw, []uint64{1, 1, 1}, flagOffset, nil)
+	bw.WriteBits(0xaa, 8)
+	bw.Close()
+	if _, err := Decompress(&buf); err != ErrOverflow {
+		t.Fatal(err)
+	}
+}
+
+func TestCount(t *testing.T) {
+	for _, k := range []int{0, 1, 200, 100000} {
+		var buf bytes.Buffer
+		Compress(&buf, sample(1000000, k))
+		xs := buf.Bytes()
+
+		for _, r := range []io.Reader{bytes.NewReader(xs), &plainReader{&buf}} {
+			n, err := Count(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != uint64(k) {
+				t.Fatalf("%d ≠ %d", n, k)
+			}
+		}
+	}
+
+	if _, err := Count(bytes.NewReader([]byte{})); err != io.EOF {
+		t.Fatal(err)
+	}
+	if _, err := Count(bytes.NewReader([]byte{0x80})); err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+	xs := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02}
+	if _, err := Count(bytes.NewReader(xs)); err != ErrUvarintOverflow {
+		t.Fatal(err)
+	}
+}
+
+func TestWideCodebook(t *testing.T) {
+	spread := []uint64{0}
+	for i := 0; i < 64; i++ {
+		spread = append(spread, spread[i]+1<<i)
+	}
+
+	for _, set := range [][]uint64{
+		{1, 2},
+		{3, 4, 5, 6},
+		sample(100000, 1000),
+		spread,
+	} {
+		set = slices.Clone(set)
+		slices.Sort(set)
+
+		var buf bytes.Buffer
+		err := compressSorted(&buf, set, flagWide, &CompressOptions{
+			CodeLengths: CodeLengths(set),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret, err := Decompress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(set, ret) {
+			t.Fatalf("%v %v", set, ret)
+		}
+	}
+
+	// A codebook for more than 64 bitlengths is valid, but unsupported.
+	for _, n := range []uint64{65, 100} {
+		buf := new(bytes.Buffer)
+		w := NewBitWriter(buf)
+		w.WriteUvarint(2)
+		w.WriteBits(0, 6)
+		w.WriteBits(uint64(flagWide), 6)
+		w.WriteUvarint(n - 1)
+		w.WriteUvarint(1)
+		w.Close()
+		if _, err := Decompress(buf); err == nil {
+			t.Fatalf("%d: expected error", n)
+		}
+	}
+}
+
+func TestCompressCursor(t *testing.T) {
+	// Spill to a temporary file, as for a large cursor.
+	defer func(m int) { maxSpillMemory = m }(maxSpillMemory)
+	maxSpillMemory = 100
+
+	for _, set := range [][]uint64{{}, {5}, sample(100000, 1000)} {
+		set = slices.Clone(set)
+		slices.Sort(set)
+
+		i := 0
+		next := func() (uint64, bool, error) {
+			if i == len(set) {
+				return 0, false, nil
+			}
+			i++
+			return set[i-1], true, nil
+		}
+
+		var buf, buf2 bytes.Buffer
+		if err := CompressCursor(&buf, next); err != nil {
+			t.Fatal(err)
+		}
+		CompressSorted(&buf2, set)
+		if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+			t.Fatalf("%x %x", buf.Bytes(), buf2.Bytes())
+		}
+	}
+
+	// Nothing is written on an error.
+	var buf bytes.Buffer
+	set := []uint64{1, 3, 3, 4}
+	i := 0
+	err := CompressCursor(&buf, func() (uint64, bool, error) {
+		if i == len(set) {
+			return 0, false, nil
+		}
+		i++
+		return set[i-1], true, nil
+	})
+	if err == nil || i != 3 || buf.Len() != 0 {
+		t.Fatalf("%v %d %d", err, i, buf.Len())
+	}
+
+	errCursor := errors.New("cursor failed")
+	i = 0
+	err = CompressCursor(&buf, func() (uint64, bool, error) {
+		if i == 2 {
+			return 0, false, errCursor
+		}
+		i++
+		return uint64(i), true, nil
+	})
+	if err != errCursor || buf.Len() != 0 {
+		t.Fatal(err, buf.Len())
+	}
+}
+
+var errFailingWriter = errors.New("write failed")
+
+// Writer that fails once more than n bytes have been written to it.
+type failingWriter struct {
+	n       int
+	written int
+}
+
+func (w *failingWriter) Write(buf []byte) (int, error) {
+	if w.written+len(buf) > w.n {
+		n := w.n - w.written
+		w.written = w.n
+		return n, errFailingWriter
+	}
+	w.written += len(buf)
+	return len(buf), nil
+}
+
+func TestFailingWriter(t *testing.T) {
+	large := sample(1<<40, 10000)
+	slices.Sort(large)
+
+	for _, tc := range []struct {
+		name     string
+		compress func(w io.Writer) error
+	}{
+		{"empty", func(w io.Writer) error {
+			return CompressSorted(w, []uint64{})
+		}},
+		{"huffman", func(w io.Writer) error {
+			return CompressSorted(w, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 1007})
+		}},
+		{"rice", func(w io.Writer) error {
+			return CompressSorted(w, large)
+		}},
+		{"large huffman", func(w io.Writer) error {
+			return CompressWithCodebook(w, large, CodeLengths(large))
+		}},
+		{"offset", func(w io.Writer) error {
+			return CompressSortedOffset(w, large)
+		}},
+	} {
+		var buf bytes.Buffer
+		if err := tc.compress(&buf); err != nil {
+			t.Fatal(err)
+		}
+		size := buf.Len()
+
+		// Streams larger than the buffer of the BitWriter fail while
+		// writing the deltas, and smaller ones when it's flushed.
+		for n := 0; n < size; n += max(1, n/8) {
+			err := tc.compress(&failingWriter{n: n})
+			if err != errFailingWriter {
+				t.Fatalf("%s %d: %v", tc.name, n, err)
+			}
+		}
+		if err := tc.compress(&failingWriter{n: size}); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+	}
+}
+
+func TestReadFiltered(t *testing.T) {
+	set := sample(100000, 2000)
+	slices.Sort(set)
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+
+	d, err := NewDecompressor(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Skip some values first, so that indices don't start at zero.
+	head := make([]uint64, 10)
+	if err := d.Read(head); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.ReadFiltered(func(i uint64) bool { return i%3 == 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []uint64
+	for i := 10; i < len(set); i++ {
+		if i%3 == 0 {
+			want = append(want, set[i])
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("%v %v", got, want)
+	}
+	if d.Remaining() != 0 {
+		t.Fatal(d.Remaining())
+	}
+}
+
+// Reader that counts the calls to Read.
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	r.reads++
+	return r.r.Read(buf)
+}
+
+func TestLazyDecompressor(t *testing.T) {
+	set := sample(100000, 1000)
+	slices.Sort(set)
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+
+	cr := &countingReader{r: buf}
+	d := NewLazyDecompressor(cr)
+	if cr.reads != 0 {
+		t.Fatal(cr.reads)
+	}
+	if d.Remaining() != uint64(len(set)) {
+		t.Fatal(d.Remaining())
+	}
+	if cr.reads == 0 {
+		t.Fatal("header not read")
+	}
+
+	got := make([]uint64, len(set))
+	if err := d.Read(got); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, set) {
+		t.Fatalf("%v %v", got, set)
+	}
+
+	// Errors reading the header are kept.
+	d = NewLazyDecompressor(bytes.NewReader([]byte{0x80}))
+	err := d.Read(make([]uint64, 1))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if d.Remaining() != 0 {
+		t.Fatal(d.Remaining())
+	}
+	if err2 := d.Read(make([]uint64, 1)); err2 != err {
+		t.Fatalf("%v %v", err, err2)
+	}
+	if _, err2 := d.SaveCursor(); err2 != err {
+		t.Fatalf("%v %v", err, err2)
+	}
+}
+
+func TestReadBatchSizes(t *testing.T) {
+	progression := make([]uint64, 100)
+	for i := range progression {
+		progression[i] = uint64(i) + 5
+	}
+
+	sets := [][]uint64{progression, {0, 1, 2, 3, 4, 5, 6, 7, 1007}}
+	for _, k := range []int{0, 1, 2, 3, 10, 1000} {
+		sets = append(sets, sample(100000, k))
+	}
+
+	for _, set := range sets {
+		slices.Sort(set)
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, set)
+		xs := buf.Bytes()
+
+		for batch := 1; batch <= len(set)+1; batch++ {
+			d, err := NewDecompressor(bytes.NewReader(xs))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []uint64
+			for d.Remaining() > 0 {
+				n := batch
+				if uint64(n) > d.Remaining() {
+					// Too large a batch doesn't read any values.
+					if err := d.Read(make([]uint64, n)); err != ErrNoMore {
+						t.Fatalf("%d %d: %v", len(set), batch, err)
+					}
+					n = int(d.Remaining())
+				}
+
+				ys := make([]uint64, n)
+				if err := d.Read(ys); err != nil {
+					t.Fatalf("%d %d: %v", len(set), batch, err)
+				}
+				got = append(got, ys...)
+			}
+
+			if !slices.Equal(got, set) {
+				t.Fatalf("%d %d: %v %v", len(set), batch, got, set)
+			}
+			if err := d.Read(make([]uint64, 1)); err != ErrNoMore {
+				t.Fatalf("%d %d: %v", len(set), batch, err)
+			}
+		}
+	}
+}
+
+func TestCompactCodebook(t *testing.T) {
+	for _, k := range []int{2, 3, 10, 16, 64, 256, 1000} {
+		set := heavyTailedSet(k)
+
+		var plain bytes.Buffer
+		if err := CompressSorted(&plain, set); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		opts := &CompressOptions{CompactCodebook: true}
+		if err := CompressSortedWithOptions(buf, set, opts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() > plain.Len() {
+			t.Fatalf("k=%d: %d > %d", k, buf.Len(), plain.Len())
+		}
+
+		set2, err := Decompress(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(set, set2) {
+			t.Fatalf("%v %v", set, set2)
+		}
+	}
+}
+
+func TestReadN(t *testing.T) {
+	set := sample(100000, 1000)
+	slices.Sort(set)
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+
+	d, err := NewDecompressor(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix, err := d.ReadN(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(prefix, set[:300]) {
+		t.Fatalf("%v %v", prefix, set[:300])
+	}
+	if d.Remaining() != 700 {
+		t.Fatal(d.Remaining())
+	}
+
+	// Asking for more than remains returns the rest.
+	rest, err := d.ReadN(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rest, set[300:]) {
+		t.Fatalf("%v %v", rest, set[300:])
+	}
+
+	rest, err = d.ReadN(1)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("%v %v", rest, err)
+	}
+
+	// Doesn't trust the size in the stream.
+	d, err = NewDecompressor(lyingSize(1 << 62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadN(math.MaxUint64); err != ErrTooLarge {
+		t.Fatal(err)
+	}
+
+	d, err = NewDecompressor(lyingSize(1 << 59))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadN(math.MaxUint64); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTwoBitLengths(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, k := range []int{2, 3, 10, 1000, 100000} {
+		set := make([]uint64, k)
+		x := uint64(0)
+		for i := range set {
+			set[i] = x
+			x += 1 + uint64(rng.Intn(3))
+		}
+
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, set)
+
+		d, err := NewDecompressor(&plainReader{bytes.NewReader(buf.Bytes())})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.NumBitLengths() != 2 {
+			t.Fatalf("k=%d: %d bitlengths", k, d.NumBitLengths())
+		}
+
+		// Read in small batches, so that we stop at every bit offset.
+		var got []uint64
+		xs := make([]uint64, 7)
+		for d.Remaining() > 0 {
+			batch := xs[:min(uint64(len(xs)), d.Remaining())]
+			if err := d.Read(batch); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, batch...)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("k=%d: %v %v", k, got, set)
+		}
+	}
+}
+
+func TestEstimatedDecodeCost(t *testing.T) {
+	sets := [][]uint64{
+		sample(1000000, 10000),
+		sample(100000000, 10000),
+		sample(20000, 10000),
+		heavyTailedSet(10000),
+	}
+
+	for _, set := range sets {
+		slices.Sort(set)
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, set)
+		size := buf.Len()
+
+		d, err := NewDecompressor(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cost := d.EstimatedDecodeCost()
+
+		// The expected bits of the deltas should be close to the
+		// actual size.
+		bits := float64(cost - d.Remaining())
+		ratio := bits / float64(8*size)
+		if ratio < 0.8 || ratio > 1.25 {
+			t.Fatalf("%d bits estimated for %d bytes", uint64(bits), size)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, []uint64{})
+	d, _ := NewDecompressor(buf)
+	if d.EstimatedDecodeCost() != 0 {
+		t.Fatal(d.EstimatedDecodeCost())
+	}
+}
+
+func TestSectionReader(t *testing.T) {
+	sets := [][]uint64{sample(100000, 1000), {1, 2, 3}, sample(1000, 10)}
+
+	// The compressed sets back to back, as members of an archive.
+	var archive bytes.Buffer
+	var offsets []int64
+	for _, set := range sets {
+		slices.Sort(set)
+		offsets = append(offsets, int64(archive.Len()))
+		CompressSorted(&archive, set)
+	}
+	offsets = append(offsets, int64(archive.Len()))
+	r := bytes.NewReader(archive.Bytes())
+
+	for i, set := range sets {
+		section := io.NewSectionReader(r, offsets[i], offsets[i+1]-offsets[i])
+		got, err := Decompress(section)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("%d: %v %v", i, got, set)
+		}
+	}
+
+	// A section that misses the last byte of the first member doesn't
+	// read on into the next one.
+	section := io.NewSectionReader(r, 0, offsets[1]-1)
+	d, err := NewDecompressor(section)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read(make([]uint64, d.Remaining())); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSeekGE(t *testing.T) {
+	set := []uint64{10, 20, 30, 40, 50}
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+	xs := buf.Bytes()
+
+	d, err := NewDecompressor(bytes.NewReader(xs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		x    uint64
+		want uint64
+		ok   bool
+	}{
+		{0, 10, true}, // before the first value
+		{20, 20, true},
+		{21, 30, true},
+		{21, 40, true}, // 30 has been consumed
+		{100, 0, false},
+		{0, 0, false}, // nothing left
+	} {
+		got, ok, err := d.SeekGE(tc.x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("SeekGE(%d) = %d, %v", tc.x, got, ok)
+		}
+	}
+
+	// Read continues after the value found, also after ReadUntil
+	// has read ahead.
+	d, _ = NewDecompressor(bytes.NewReader(xs))
+	ys := make([]uint64, 5)
+	if n, _ := d.ReadUntil(15, ys); n != 1 {
+		t.Fatal(n)
+	}
+	if got, ok, _ := d.SeekGE(25); got != 30 || !ok {
+		t.Fatalf("%d %v", got, ok)
+	}
+	if err := d.Read(ys[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ys[:2], []uint64{40, 50}) {
+		t.Fatal(ys[:2])
+	}
+
+	large := sample(1000000, 10000)
+	slices.Sort(large)
+	buf.Reset()
+	CompressSorted(buf, large)
+	d, _ = NewDecompressor(buf)
+	x := uint64(0)
+	allocs := testing.AllocsPerRun(100, func() {
+		x += 1000
+		d.SeekGE(x)
+	})
+	if allocs != 0 {
+		t.Fatalf("%v allocations", allocs)
+	}
+}
+
+func TestContains(t *testing.T) {
+	for _, set := range [][]uint64{{}, {0}, {7}, {1, 5, 9}, {1<<64 - 1}} {
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, set)
+		xs := buf.Bytes()
+
+		for _, x := range []uint64{0, 1, 5, 6, 7, 9, 10, 1<<64 - 1} {
+			got, err := Contains(bytes.NewReader(xs), x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != slices.Contains(set, x) {
+				t.Fatalf("%v: Contains(%d) = %v", set, x, got)
+			}
+		}
+	}
+}
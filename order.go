@@ -0,0 +1,227 @@
+package ncrlite
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"math/bits"
+	"slices"
+)
+
+// Writes a compressed version of set to w, that also stores the order
+// of the values, which is restored by DecompressWithOrder.
+//
+// The values may repeat: they're stored as by CompressMultiset, followed
+// by the permutation that puts them back in order. That takes at most
+// OrderBits(len(set)) bits, roughly lg n!, but much less if the values
+// were nearly sorted. Does not modify set.
+func CompressWithOrder(w io.Writer, set []uint64) error {
+	sorted, rank := sortWithRanks(set)
+	keys, repeats := countRepeats(sorted)
+	sorted = nil
+
+	bw := NewBitWriter(w)
+	if err := writeColumns(bw, keys, repeats); err != nil {
+		return err
+	}
+	if err := bw.Err(); err != nil {
+		return err
+	}
+	keys, repeats = nil, nil
+
+	writeOrder(bw, rank)
+	return bw.Close()
+}
+
+// Decompresses values written by CompressWithOrder from r.
+//
+// The returned slice is in the same order as the original, including
+// any repeats.
+func DecompressWithOrder(r io.Reader) ([]uint64, error) {
+	br := NewBitReader(r)
+	c, err := newColumnsDecompressor(br)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, repeats, err := c.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	sorted, err := expandRepeats(keys, repeats)
+	if err != nil {
+		return nil, err
+	}
+
+	return readOrder(br, sorted)
+}
+
+// Returns the number of bits CompressWithOrder uses at most to store the
+// order of n values.
+func OrderBits(n int) uint64 {
+	if n <= 1 {
+		return 0
+	}
+	return 1 + lehmerBits(n)
+}
+
+// Returns the number of bits of the Lehmer code of a permutation of n
+// values in fixed-width fields.
+func lehmerBits(n int) uint64 {
+	var ret uint64
+	for i := 0; i < n; i++ {
+		ret += uint64(bits.Len(uint(n - i - 1)))
+	}
+	return ret
+}
+
+// Returns set sorted, and the rank of each of its values in there. Equal
+// values are ranked in the order they appear.
+func sortWithRanks(set []uint64) ([]uint64, []int) {
+	n := len(set)
+
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	slices.SortStableFunc(idx, func(a, b int) int {
+		return cmp.Compare(set[a], set[b])
+	})
+
+	sorted := make([]uint64, n)
+	rank := make([]int, n)
+	for r, i := range idx {
+		sorted[r] = set[i]
+		rank[i] = r
+	}
+
+	return sorted, rank
+}
+
+// Writes the Lehmer code of the permutation given by rank: for each
+// value but the last, the number of smaller values that come after it.
+// The ith number is below n-i.
+//
+// If the values were nearly sorted, most of these numbers are small, and
+// we Huffman code them as the values of CompressColumns. Otherwise they
+// are close to uniformly distributed, and it's smaller to write the ith
+// in bits.Len(n-i-1) bits. A single bit, set for the former, tells which.
+func writeOrder(bw *BitWriter, rank []int) {
+	n := len(rank)
+	if n <= 1 {
+		return
+	}
+
+	lehmer := make([]uint64, n-1)
+	unused := newFenwick(n)
+	for i, r := range rank[:n-1] {
+		lehmer[i] = uint64(unused.Prefix(r))
+		unused.Add(r, -1)
+	}
+
+	freq := valueFreqs(lehmer)
+	code := buildHuffmanCode(freq)
+	if valueBits(code, freq) >= lehmerBits(n) {
+		bw.WriteBits(0, 1)
+		for i, c := range lehmer {
+			bw.WriteBits(c, bits.Len(uint(n-i-1)))
+		}
+		return
+	}
+
+	bw.WriteBits(1, 1)
+	code.Pack(bw, columnWidth)
+	for _, c := range lehmer {
+		writeValue(bw, code, c)
+	}
+}
+
+// Reads the permutation written by writeOrder, and returns the values
+// of sorted in that order.
+func readOrder(br *BitReader, sorted []uint64) ([]uint64, error) {
+	n := len(sorted)
+	if n <= 1 {
+		return sorted, nil
+	}
+
+	// A nil table is a valid code, for when all numbers are zero.
+	var lut htLut
+	huffman := br.ReadBit() == 1
+	if huffman {
+		var err error
+		lut, err = readValueCodebook(br)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make([]uint64, n)
+	unused := newFenwick(n)
+
+	for i := range ret {
+		var c uint64
+		switch {
+		case i == n-1:
+		case huffman:
+			c = readValue(br, lut)
+		default:
+			c = br.ReadBits(byte(bits.Len(uint(n - i - 1))))
+		}
+		if c >= uint64(n-i) {
+			return nil, errInvalidPermutation
+		}
+		r := unused.Find(int(c))
+		unused.Add(r, -1)
+		ret[i] = sorted[r]
+	}
+
+	if err := br.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+var errInvalidPermutation = errors.New("Invalid permutation")
+
+// Fenwick tree that keeps track of which of the indices 0, ..., n-1 are
+// still in use.
+type fenwick []int
+
+// Returns a Fenwick tree with all of 0, ..., n-1 in use.
+func newFenwick(n int) fenwick {
+	f := make(fenwick, n+1)
+	for i := 1; i <= n; i++ {
+		f[i] = i & -i
+	}
+	return f
+}
+
+// Adds delta to the count of index i.
+func (f fenwick) Add(i int, delta int) {
+	for i++; i < len(f); i += i & -i {
+		f[i] += delta
+	}
+}
+
+// Returns the sum of the counts of the indices below i.
+func (f fenwick) Prefix(i int) int {
+	ret := 0
+	for ; i > 0; i -= i & -i {
+		ret += f[i]
+	}
+	return ret
+}
+
+// Returns the index i for which Prefix(i) = k and i is in use.
+func (f fenwick) Find(k int) int {
+	i := 0
+	for step := 1 << (bits.Len(uint(len(f))) - 1); step > 0; step >>= 1 {
+		if i+step < len(f) && f[i+step] <= k {
+			i += step
+			k -= f[i]
+		}
+	}
+	return i
+}
@@ -0,0 +1,128 @@
+package ncrlite
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestWithOrder(t *testing.T) {
+	large := make([]uint64, 10000)
+	for i := range large {
+		large[i] = uint64(rand.Intn(3000))
+	}
+
+	sets := [][]uint64{
+		{},
+		{7},
+		{7, 7},
+		{5, 1, 9, 1, 5, 1},
+		{1, 1, 5, 9, 1, 5},
+		{1<<64 - 1, 0, 1<<64 - 1},
+		large,
+	}
+	for _, k := range []int{2, 3, 100, 10000} {
+		set := sample(1000000, k)
+		rand.Shuffle(len(set), func(i, j int) {
+			set[i], set[j] = set[j], set[i]
+		})
+		sets = append(sets, set)
+
+		// Sorted and nearly sorted, so that the order is Huffman coded.
+		set = slices.Sorted(slices.Values(set))
+		sets = append(sets, set)
+		set = slices.Clone(set)
+		set[0], set[len(set)-1] = set[len(set)-1], set[0]
+		sets = append(sets, set)
+	}
+
+	for _, set := range sets {
+		orig := slices.Clone(set)
+
+		buf := new(bytes.Buffer)
+		if err := CompressWithOrder(buf, set); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(set, orig) {
+			t.Fatal("input modified")
+		}
+
+		got, err := DecompressWithOrder(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, set) {
+			t.Fatalf("%v %v", got, set)
+		}
+	}
+}
+
+func TestDecompressWithOrderLyingSize(t *testing.T) {
+	// The values are stored as columns, so the stream has to go on with
+	// the codebook for the repeats.
+	lying := func(size uint64) *bytes.Buffer {
+		buf := lyingSize(size)
+		w := NewBitWriter(buf)
+		buildHuffmanCode([]int{1}).Pack(w, columnWidth)
+		w.Close()
+		return buf
+	}
+
+	if _, err := DecompressWithOrder(lying(1 << 62)); err != ErrTooLarge {
+		t.Fatal(err)
+	}
+	if _, err := DecompressWithOrder(lying(1 << 59)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestOrderBits(t *testing.T) {
+	set := sample(1000000, 1000)
+
+	buf := new(bytes.Buffer)
+	CompressMultiset(buf, slices.Clone(set))
+	size := buf.Len()
+
+	// A random order takes about OrderBits, up to padding to a byte.
+	buf.Reset()
+	CompressWithOrder(buf, set)
+	got, want := uint64(buf.Len()-size)*8, OrderBits(len(set))
+	if got >= want+8 || got+64 <= want {
+		t.Fatalf("%d %d", got, want)
+	}
+
+	// A nearly sorted order takes about a bit per value, and a sorted one
+	// next to nothing.
+	slices.Sort(set)
+	set[500], set[501] = set[501], set[500]
+	buf.Reset()
+	CompressWithOrder(buf, set)
+	if got := uint64(buf.Len()-size) * 8; got >= OrderBits(len(set))/4 {
+		t.Fatalf("%d", got)
+	}
+
+	slices.Sort(set)
+	buf.Reset()
+	CompressWithOrder(buf, set)
+	if got := buf.Len() - size; got > 4 {
+		t.Fatalf("%d", got)
+	}
+}
+
+func TestFenwick(t *testing.T) {
+	f := newFenwick(10)
+	f.Add(3, -1)
+	f.Add(0, -1)
+	f.Add(9, -1)
+
+	unused := []int{1, 2, 4, 5, 6, 7, 8}
+	for k, i := range unused {
+		if f.Find(k) != i {
+			t.Fatalf("Find(%d) = %d ≠ %d", k, f.Find(k), i)
+		}
+		if f.Prefix(i) != k {
+			t.Fatalf("Prefix(%d) = %d ≠ %d", i, f.Prefix(i), k)
+		}
+	}
+}
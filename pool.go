@@ -0,0 +1,31 @@
+package ncrlite
+
+import (
+	"sync"
+)
+
+// Length of the buffers returned by GetBuffer.
+const BufferSize = 512
+
+// Holds *[BufferSize]uint64, so that PutBuffer can put back the pointer
+// GetBuffer got, without allocating.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new([BufferSize]uint64)
+	},
+}
+
+// Returns a buffer of BufferSize uint64s to pass to Decompressor.Read.
+//
+// Return it with PutBuffer when done, so that it can be reused.
+func GetBuffer() []uint64 {
+	return bufferPool.Get().(*[BufferSize]uint64)[:]
+}
+
+// Returns a buffer obtained from GetBuffer to the pool.
+func PutBuffer(buf []uint64) {
+	if cap(buf) < BufferSize {
+		return
+	}
+	bufferPool.Put((*[BufferSize]uint64)(buf[:BufferSize]))
+}
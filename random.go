@@ -0,0 +1,196 @@
+package ncrlite
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Marks the end of an index, after its length.
+const indexMagic = "NCRI"
+
+var errCorruptIndex = errors.New("Corrupt index")
+
+// Position in the stream from which the deltas can be decoded.
+type checkpoint struct {
+	pos  uint64 // in bits from the start of the set
+	prev uint64 // value before the delta at pos
+}
+
+// Writes the index for the checkpoints, of which there's one every
+// so many values, aligned to a byte. Like the footer, it ends with its
+// length and indexMagic, so that it can be found from the end.
+func writeIndex(bw *BitWriter, every uint64, checkpoints []checkpoint) {
+	buf := binary.AppendUvarint(nil, every)
+	buf = binary.AppendUvarint(buf, uint64(len(checkpoints)))
+	var prev checkpoint
+	for _, c := range checkpoints {
+		buf = binary.AppendUvarint(buf, c.pos-prev.pos)
+		buf = binary.AppendUvarint(buf, c.prev-prev.prev)
+		prev = c
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(buf)))
+	buf = append(buf, indexMagic...)
+
+	bw.WriteBits(0, (8-bw.offset%8)%8)
+	for _, b := range buf {
+		bw.WriteBits(uint64(b), 8)
+	}
+}
+
+// Splits data into the compressed set and its index, which is nil if
+// there is none. Skips the footer, if any.
+func splitIndex(data []byte) (set, index []byte, err error) {
+	end := len(data)
+	if end >= 1+len(footerMagic) && string(data[end-len(footerMagic):]) == footerMagic {
+		end -= 1 + len(footerMagic) + int(data[end-1-len(footerMagic)])
+		if end < 0 {
+			return nil, nil, errCorruptIndex
+		}
+	}
+
+	if end < 4+len(indexMagic) || string(data[end-len(indexMagic):end]) != indexMagic {
+		return data[:end], nil, nil
+	}
+
+	end -= len(indexMagic) + 4
+	size := uint64(binary.LittleEndian.Uint32(data[end:]))
+	if size > uint64(end) {
+		return nil, nil, errCorruptIndex
+	}
+	start := end - int(size)
+	return data[:start], data[start:end], nil
+}
+
+// Finds values in a compressed set by their rank, using the index written
+// with the SampleEvery option. Without an index, decodes from the start.
+//
+// Select may be called concurrently.
+type RandomAccess struct {
+	d           *Decompressor // with the header read, but no values
+	data        []byte        // the compressed set, without the index
+	start       uint64        // bit offset of the first delta in data
+	every       uint64        // number of values between checkpoints
+	checkpoints []checkpoint
+}
+
+// Returns a RandomAccess for the compressed set in data.
+func NewRandomAccess(data []byte) (*RandomAccess, error) {
+	set, index, err := splitIndex(data)
+	if err != nil {
+		return nil, err
+	}
+
+	br := newSliceBitReader(set)
+	d, err := newDecompressor(br, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ra := &RandomAccess{
+		d:     d,
+		data:  set,
+		start: uint64(br.total)*8 - uint64(br.size),
+		every: max(d.size, 1),
+	}
+
+	if index != nil {
+		if err := ra.readIndex(index); err != nil {
+			return nil, err
+		}
+	}
+
+	return ra, nil
+}
+
+// Reads the checkpoints from index.
+func (ra *RandomAccess) readIndex(index []byte) error {
+	uvarint := func() uint64 {
+		x, n := binary.Uvarint(index)
+		if n <= 0 {
+			index = nil
+			return 0
+		}
+		index = index[n:]
+		return x
+	}
+
+	every := uvarint()
+	count := uvarint()
+	if index == nil || every == 0 {
+		return errCorruptIndex
+	}
+
+	// There's a checkpoint before every chunk but the first.
+	if ra.d.size > 1 && count != (ra.d.size-1)/every {
+		return errCorruptIndex
+	}
+	if ra.d.size <= 1 && count != 0 {
+		return errCorruptIndex
+	}
+
+	// Don't trust count for the allocation: each checkpoint takes at
+	// least two bytes.
+	if count > uint64(len(index))/2 {
+		return errCorruptIndex
+	}
+
+	checkpoints := make([]checkpoint, count)
+	var prev checkpoint
+	for i := range checkpoints {
+		prev.pos += uvarint()
+		prev.prev += uvarint()
+		if index == nil || prev.pos > 8*uint64(len(ra.data)) {
+			return errCorruptIndex
+		}
+		checkpoints[i] = prev
+	}
+
+	ra.every = every
+	ra.checkpoints = checkpoints
+	return nil
+}
+
+// Returns the number of values in the set.
+func (ra *RandomAccess) Len() uint64 {
+	return ra.d.size
+}
+
+// Returns the value of rank i, that is, the (i+1)th smallest value in
+// the set. Decodes at most as many values as there are between two
+// checkpoints.
+//
+// Returns ErrNoMore if i isn't smaller than Len.
+func (ra *RandomAccess) Select(i uint64) (uint64, error) {
+	if i >= ra.d.size {
+		return 0, ErrNoMore
+	}
+
+	c := min(i/ra.every, uint64(len(ra.checkpoints)))
+
+	// A copy of the Decompressor, which only shares the Huffman tree.
+	d := *ra.d
+	pos := ra.start
+	if c > 0 {
+		pos = ra.checkpoints[c-1].pos
+		d.prev = ra.checkpoints[c-1].prev
+		d.started = true
+	}
+	d.remaining = ra.d.size - c*ra.every
+
+	d.br = newSliceBitReader(ra.data[pos/8:])
+	d.br.total = int(pos / 8)
+	d.br.SkipBits(byte(pos % 8))
+
+	var buf [64]uint64
+	n := i - c*ra.every + 1
+	for {
+		xs := buf[:min(n, uint64(len(buf)))]
+		if err := d.Read(xs); err != nil {
+			return 0, err
+		}
+		n -= uint64(len(xs))
+		if n == 0 {
+			return xs[len(xs)-1], nil
+		}
+	}
+}
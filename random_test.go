@@ -0,0 +1,80 @@
+package ncrlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func TestRandomAccess(t *testing.T) {
+	sets := [][]uint64{
+		{},
+		{42},
+		{1, 2},
+		sample(1000000, 5000), // Rice code
+		heavyTailedSet(5000),  // Huffman code
+	}
+
+	for _, set := range sets {
+		slices.Sort(set)
+
+		for _, opts := range []*CompressOptions{
+			nil,
+			{SampleEvery: 1},
+			{SampleEvery: 7},
+			{SampleEvery: 64, Footer: true},
+			{SampleEvery: 10000},
+		} {
+			buf := new(bytes.Buffer)
+			if err := CompressSortedWithOptions(buf, set, opts); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.Bytes()
+
+			ra, err := NewRandomAccess(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ra.Len() != uint64(len(set)) {
+				t.Fatalf("%d %d", ra.Len(), len(set))
+			}
+			for i, want := range set {
+				got, err := ra.Select(uint64(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Fatalf("%+v: Select(%d) = %d ≠ %d", opts, i, got, want)
+				}
+			}
+			if _, err := ra.Select(uint64(len(set))); err != ErrNoMore {
+				t.Fatal(err)
+			}
+
+			// The index doesn't get in the way of plain decompression.
+			got, err := Decompress(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, set) {
+				t.Fatalf("%v %v", got, set)
+			}
+		}
+	}
+}
+
+func TestRandomAccessLyingIndex(t *testing.T) {
+	// Claims 2⁶² values, and a checkpoint for each after the first.
+	data := lyingSize(1 << 62).Bytes()
+	index := binary.AppendUvarint(nil, 1)
+	index = binary.AppendUvarint(index, 1<<62-1)
+	index = append(index, 1, 1)
+	data = append(data, index...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(index)))
+	data = append(data, indexMagic...)
+
+	if _, err := NewRandomAccess(data); err != errCorruptIndex {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+)
+
+// Writes a compressed version of set to w as a difference against base,
+// which is restored by DecompressRelated given the same base.
+//
+// Stores the positions in base of the values that are not in set, and the
+// values of set that are not in base. If set mostly repeats base, this is
+// much smaller than compressing set on its own.
+//
+// Both base and set have to be sorted and may not contain duplicates.
+func CompressRelated(w io.Writer, base, set []uint64) error {
+	var removed, added []uint64
+
+	i, j := 0, 0
+	for i < len(base) || j < len(set) {
+		if j == len(set) || (i < len(base) && base[i] < set[j]) {
+			removed = append(removed, uint64(i))
+			i++
+		} else if i == len(base) || set[j] < base[i] {
+			added = append(added, set[j])
+			j++
+		} else {
+			i++
+			j++
+		}
+	}
+
+	bw := NewBitWriter(w)
+	if err := writeSet(bw, removed, 0, nil); err != nil {
+		return err
+	}
+	if err := writeSet(bw, added, 0, nil); err != nil {
+		return err
+	}
+	return bw.Close()
+}
+
+// Decompresses a set of uint64s written by CompressRelated from r,
+// against the same base.
+//
+// The returned slice will be sorted.
+func DecompressRelated(r io.Reader, base []uint64) ([]uint64, error) {
+	br := NewBitReader(r)
+
+	d, err := newDecompressor(br, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.Remaining() > uint64(len(base)) {
+		return nil, errBaseMismatch
+	}
+	removed, err := d.readN(d.Remaining())
+	if err != nil {
+		return nil, err
+	}
+	if len(removed) > 0 && removed[len(removed)-1] >= uint64(len(base)) {
+		return nil, errBaseMismatch
+	}
+
+	d, err = newDecompressor(br, nil)
+	if err != nil {
+		return nil, err
+	}
+	added, err := d.readN(d.Remaining())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]uint64, 0, len(base)-len(removed)+len(added))
+	i, j, k := 0, 0, 0
+	for i < len(base) || k < len(added) {
+		if j < len(removed) && removed[j] == uint64(i) {
+			i++
+			j++
+		} else if k == len(added) || (i < len(base) && base[i] < added[k]) {
+			ret = append(ret, base[i])
+			i++
+		} else if i == len(base) || added[k] < base[i] {
+			ret = append(ret, added[k])
+			k++
+		} else {
+			// Added values are never in base.
+			return nil, errBaseMismatch
+		}
+	}
+
+	return ret, nil
+}
+
+var errBaseMismatch = errors.New("Set was not compressed against this base")
@@ -0,0 +1,74 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestRelated(t *testing.T) {
+	base := sample(100000, 1000)
+	slices.Sort(base)
+
+	// Drop some values of base and add some others.
+	set := []uint64{}
+	for i, x := range base {
+		if i%50 != 7 {
+			set = append(set, x)
+		}
+	}
+	for _, x := range sample(100000, 20) {
+		if _, found := slices.BinarySearch(base, x); !found {
+			set = append(set, x)
+		}
+	}
+	slices.Sort(set)
+	set = slices.Compact(set)
+
+	for _, tc := range [][2][]uint64{
+		{base, set},
+		{base, base},
+		{base, nil},
+		{nil, set},
+		{nil, nil},
+	} {
+		var buf bytes.Buffer
+		if err := CompressRelated(&buf, tc[0], tc[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		ret, err := DecompressRelated(&buf, tc[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(ret, tc[1]) {
+			t.Fatalf("%v %v", ret, tc[1])
+		}
+	}
+
+	var buf, buf2 bytes.Buffer
+	CompressRelated(&buf, base, set)
+	CompressSorted(&buf2, set)
+	if buf.Len() >= buf2.Len()/2 {
+		t.Fatalf("%d %d", buf.Len(), buf2.Len())
+	}
+}
+
+func TestDecompressRelatedLyingSize(t *testing.T) {
+	base := []uint64{1, 2, 3}
+
+	// Nothing removed, but claims to add 2⁶² or 2⁵⁹ values.
+	for _, size := range []uint64{1 << 62, 1 << 59} {
+		buf := new(bytes.Buffer)
+		CompressSorted(buf, []uint64{})
+		lyingSize(size).WriteTo(buf)
+		if _, err := DecompressRelated(buf, base); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	if _, err := DecompressRelated(lyingSize(1<<62), base); err != errBaseMismatch {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,200 @@
+package ncrlite
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Returns the Rice parameter k that minimises the size of the deltas of
+// set when Rice coded, and that size in bits, which doesn't include the
+// size of the set and the header.
+//
+// Returns an error if set isn't sorted or has duplicates.
+func OptimalRiceParam(set []uint64) (k uint8, estBits uint64, err error) {
+	ds, err := toDeltas(set, 0)
+	if err == ErrOverflow {
+		// The set is just 2⁶⁴-1, which is stored without deltas.
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	k, estBits = optimalRice(ds, 0)
+	return k, estBits, nil
+}
+
+// Returns the Rice parameter that minimises the size of the deltas ds,
+// plus another ones deltas that are one, and the number of bits they take.
+func optimalRice(ds []uint64, ones uint64) (uint8, uint64) {
+	size := func(k uint8) uint64 {
+		return satAdd(riceBits(ds, k), satMul(ones, uint64(k)+1))
+	}
+
+	sum := 0.0
+	for _, d := range ds {
+		sum += float64(d - 1)
+	}
+	return minimizeRice(sum/float64(uint64(len(ds))+ones), size)
+}
+
+// Returns the Rice parameter k that minimises size(k), the number of bits
+// of deltas with the given mean minus one, and that minimum.
+func minimizeRice(mean float64, size func(k uint8) uint64) (uint8, uint64) {
+	// The size is convex in the parameter, so we can walk from an
+	// estimate to the minimum: the bitlength of the average delta.
+	k := uint8(63)
+	if mean < 1<<63 {
+		k = uint8(max(bits.Len64(uint64(mean))-1, 0))
+	}
+	best := size(k)
+
+	for k < 63 {
+		next := size(k + 1)
+		if next >= best {
+			break
+		}
+		k, best = k+1, next
+	}
+
+	for k > 0 {
+		next := size(k - 1)
+		if next > best {
+			break
+		}
+		k, best = k-1, next
+	}
+
+	return k, best
+}
+
+// Returns the number of bits of the deltas when Rice coded with parameter k:
+// the quotient of d-1 by 2ᵏ in unary and the remainder in k bits.
+func riceBits(ds []uint64, k uint8) uint64 {
+	ret := uint64(0)
+	for _, d := range ds {
+		ret = satAdd(ret, satAdd((d-1)>>k, uint64(k)+1))
+	}
+	return ret
+}
+
+// Writes the non-zero deltas ds to bw, Rice coded with parameter k.
+func writeRice(bw *BitWriter, ds []uint64, k uint8) {
+	for _, d := range ds {
+		q := (d - 1) >> k
+		for ; q >= 32; q -= 32 {
+			bw.WriteBits(0, 32)
+		}
+		bw.WriteBits(1<<q, int(q)+1)
+		bw.WriteBits((d-1)&(1<<k-1), int(k))
+	}
+}
+
+// Reads Rice coded deltas into set.
+func (d *Decompressor) readRice(set []uint64) error {
+	if d.riceK == 0 {
+		return d.readBitmap(set)
+	}
+
+	maxQ := uint64(math.MaxUint64) >> d.riceK
+
+	for i := 0; i < len(set); i++ {
+		q := d.br.ReadUnary(maxQ)
+		if q > maxQ {
+			return ErrOverflow
+		}
+		if err := d.br.Err(); err != nil {
+			return err
+		}
+
+		delta := (q<<d.riceK | d.br.ReadBits(d.riceK)) + 1
+		if delta == 0 {
+			return ErrOverflow
+		}
+
+		val := d.prev + delta
+
+		if !d.started {
+			val-- // we shifted the first value so it can't be zero as delta
+			d.started = true
+		}
+
+		// The first value is compared to the offset, if any.
+		if val < d.prev {
+			return ErrOverflow
+		}
+
+		d.prev = val
+		set[i] = val
+	}
+
+	return nil
+}
+
+// Reads deltas Rice coded with k = 0 into set. Then the stream is a bitmap
+// of the set, where each value is a one bit, which we find a word at
+// a time.
+func (d *Decompressor) readBitmap(set []uint64) error {
+	br := d.br
+	gap := uint64(0) // zero bits since the previous value
+
+	for i := 0; i < len(set); {
+		if br.buf == 0 {
+			gap += uint64(br.size)
+			br.size = 0
+			if !br.fill() {
+				return br.Err()
+			}
+			continue
+		}
+
+		tz := byte(bits.TrailingZeros64(br.buf))
+		br.buf >>= tz
+		br.buf >>= 1
+		br.size -= tz + 1
+
+		delta := gap + uint64(tz) + 1
+		gap = 0
+		if delta == 0 {
+			return ErrOverflow
+		}
+
+		val := d.prev + delta
+
+		if !d.started {
+			val-- // we shifted the first value so it can't be zero as delta
+			d.started = true
+		}
+
+		if val < d.prev {
+			return ErrOverflow
+		}
+
+		d.prev = val
+		set[i] = val
+		i++
+	}
+
+	return nil
+}
+
+// Returns the optimal Rice parameter for the deltas ds, and whether Rice
+// coding them is smaller than using code, the Huffman code for their
+// bitlengths with frequencies freq, in the format variant given by flags.
+func preferRice(ds []uint64, freq []int, code htCode, flags byte) (uint8, bool) {
+	k, rice := optimalRice(ds, 0)
+	return k, riceSmaller(rice, freq, code, flags)
+}
+
+// Returns whether deltas that take rice bits when Rice coded are smaller
+// that way than with code, the Huffman code for their bitlengths with
+// frequencies freq, in the format variant given by flags.
+func riceSmaller(rice uint64, freq []int, code htCode, flags byte) bool {
+	// The Rice variant needs an extended header and the parameter.
+	rice = satAdd(rice, 6)
+	huffman := code.encodedBits(freq, codebookWidth(flags))
+	if flags == 0 {
+		rice = satAdd(rice, 12)
+	}
+
+	return rice < huffman
+}
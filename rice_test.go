@@ -0,0 +1,134 @@
+package ncrlite
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestRice(t *testing.T) {
+	// Contains about 90% of the values below 10⁵, for which k = 0.
+	rng := rand.New(rand.NewSource(1))
+	var dense []uint64
+	for x := uint64(0); x < 100000; x++ {
+		if rng.Intn(10) != 0 {
+			dense = append(dense, x)
+		}
+	}
+
+	for _, tc := range []struct {
+		set  []uint64
+		rice bool
+	}{
+		{sample(100000, 1000), true},
+		{sample(1<<40, 1000), true},
+		{dense, true},
+		{[]uint64{1<<64 - 3, 1<<64 - 2}, true},
+		{[]uint64{0, 1<<63 + 5, 1<<64 - 2}, true},
+		{[]uint64{0, 1, 2, 3, 4, 5, 6, 7, 1007}, false},
+		{[]uint64{0, 1, 2, 3}, false},
+	} {
+		slices.Sort(tc.set)
+
+		var buf bytes.Buffer
+		CompressSorted(&buf, tc.set)
+		size := buf.Len()
+
+		d, err := NewDecompressor(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (d.flags&flagRice != 0) != tc.rice {
+			t.Fatalf("%v: %06b", tc.set, d.flags)
+		}
+
+		ret := make([]uint64, d.Remaining())
+		if err := d.Read(ret); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ret, tc.set) {
+			t.Fatalf("%v %v", ret, tc.set)
+		}
+
+		// Compare with the size of the Huffman coded version.
+		buf.Reset()
+		CompressWithCodebook(&buf, tc.set, CodeLengths(tc.set))
+		if (size < buf.Len()) != tc.rice {
+			t.Fatalf("%d %d", size, buf.Len())
+		}
+	}
+}
+
+func TestRiceLargeQuotient(t *testing.T) {
+	// With k = 0, a delta of 100 has a quotient of 99.
+	ds := []uint64{1, 100, 3, 70}
+	buf := new(bytes.Buffer)
+	bw := NewBitWriter(buf)
+	bw.WriteUvarint(uint64(len(ds)))
+	bw.WriteBits(0, 6)
+	bw.WriteBits(uint64(flagRice), 6)
+	bw.WriteBits(0, 6)
+	writeRice(bw, ds, 0)
+	bw.WriteBits(0xaa, 8)
+	bw.Close()
+	xs := buf.Bytes()
+
+	ret, err := Decompress(bytes.NewReader(xs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ret, []uint64{0, 100, 103, 173}) {
+		t.Fatalf("%v", ret)
+	}
+
+	for l := 0; l < len(xs); l++ {
+		if _, err := Decompress(bytes.NewReader(xs[:l])); err == nil {
+			t.Fatalf("%d: expected error", l)
+		}
+	}
+}
+
+func TestOptimalRiceParam(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sets := [][]uint64{{}, {0}, {1<<64 - 1}, {0, 1<<64 - 1}}
+	for _, N := range []int{10, 1000, 1 << 20, 1 << 40} {
+		for _, k := range []int{1, 2, 10, 1000} {
+			if k <= N {
+				sets = append(sets, sample(N, k))
+			}
+		}
+	}
+
+	// Sets of which the deltas vary wildly.
+	for i := 0; i < 100; i++ {
+		var set []uint64
+		x := uint64(0)
+		for j := 0; j < 20; j++ {
+			next := x + 1 + rng.Uint64()>>(rng.Intn(64)+1)
+			if next < x {
+				break
+			}
+			set = append(set, next)
+			x = next
+		}
+		sets = append(sets, set)
+	}
+
+	for _, set := range sets {
+		slices.Sort(set)
+		k, bits, err := OptimalRiceParam(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ds, _ := toDeltas(set, 0)
+		best := riceBits(ds, 0)
+		for k := uint8(1); k < 64; k++ {
+			best = min(best, riceBits(ds, k))
+		}
+		if bits != best || riceBits(ds, k) != best {
+			t.Fatalf("%v: %d %d %d", set, k, bits, best)
+		}
+	}
+}
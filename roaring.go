@@ -0,0 +1,211 @@
+package ncrlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Cookies at the start of a serialized Roaring bitmap, which tell whether
+// it may contain run containers.
+const (
+	roaringCookie      = 12347
+	roaringCookieNoRun = 12346
+)
+
+// Containers with more values than this are stored as a bitmap.
+const roaringMaxArray = 4096
+
+var (
+	errRoaringCorrupt  = errors.New("Corrupt Roaring bitmap")
+	errRoaringTooLarge = errors.New("Value doesn't fit in a Roaring bitmap")
+)
+
+// Writes a compressed version of the set in data, a Roaring bitmap in
+// its portable serialization, to w.
+func CompressRoaring(w io.Writer, data []byte) error {
+	set, err := parseRoaring(data)
+	if err != nil {
+		return err
+	}
+	return CompressSorted(w, set)
+}
+
+// Decompresses a set from r and returns it as a Roaring bitmap in its
+// portable serialization, without run containers.
+//
+// Returns an error if the set has a value of 2³² or more.
+func DecompressToRoaring(r io.Reader) ([]byte, error) {
+	set, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(set) > 0 && set[len(set)-1] > 0xffffffff {
+		return nil, errRoaringTooLarge
+	}
+
+	// Split the set into containers by the upper 16 bits.
+	var containers [][]uint64
+	for i := 0; i < len(set); {
+		j := i + 1
+		for j < len(set) && set[j]>>16 == set[i]>>16 {
+			j++
+		}
+		containers = append(containers, set[i:j])
+		i = j
+	}
+
+	ret := binary.LittleEndian.AppendUint32(nil, roaringCookieNoRun)
+	ret = binary.LittleEndian.AppendUint32(ret, uint32(len(containers)))
+	for _, c := range containers {
+		ret = binary.LittleEndian.AppendUint16(ret, uint16(c[0]>>16))
+		ret = binary.LittleEndian.AppendUint16(ret, uint16(len(c)-1))
+	}
+
+	// The offsets of the containers from the start.
+	offset := len(ret) + 4*len(containers)
+	for _, c := range containers {
+		ret = binary.LittleEndian.AppendUint32(ret, uint32(offset))
+		if len(c) > roaringMaxArray {
+			offset += 8192
+		} else {
+			offset += 2 * len(c)
+		}
+	}
+
+	for _, c := range containers {
+		if len(c) <= roaringMaxArray {
+			for _, x := range c {
+				ret = binary.LittleEndian.AppendUint16(ret, uint16(x))
+			}
+			continue
+		}
+
+		var bm [1024]uint64
+		for _, x := range c {
+			bm[uint16(x)/64] |= 1 << (x % 64)
+		}
+		for _, word := range bm {
+			ret = binary.LittleEndian.AppendUint64(ret, word)
+		}
+	}
+
+	return ret, nil
+}
+
+// Returns the values in the serialized Roaring bitmap data.
+func parseRoaring(data []byte) ([]uint64, error) {
+	r := roaringReader{data: data}
+
+	cookie := r.uint32()
+	var (
+		n      int
+		isRun  []byte // bitmap of which containers are run containers
+		hasRun bool
+	)
+	switch {
+	case cookie&0xffff == roaringCookie:
+		n = int(cookie>>16) + 1
+		isRun = r.bytes((n + 7) / 8)
+		hasRun = true
+	case cookie == roaringCookieNoRun:
+		n = int(r.uint32())
+	default:
+		return nil, errRoaringCorrupt
+	}
+
+	// There are at most 2¹⁶ containers, each with a four byte header.
+	if n > 1<<16 || 4*n > len(r.data) {
+		return nil, errRoaringCorrupt
+	}
+
+	keys := make([]uint16, n)
+	cards := make([]int, n)
+	for i := range keys {
+		keys[i] = r.uint16()
+		cards[i] = int(r.uint16()) + 1
+	}
+
+	// Skip the offsets of the containers, as they follow each other.
+	if !hasRun || n >= 4 {
+		r.bytes(4 * n)
+	}
+
+	var set []uint64
+	for i, key := range keys {
+		high := uint64(key) << 16
+
+		if hasRun && isRun[i/8]&(1<<(i%8)) != 0 {
+			runs := int(r.uint16())
+			for j := 0; j < runs && r.err == nil; j++ {
+				start := uint64(r.uint16())
+				end := start + uint64(r.uint16())
+				if end > 0xffff {
+					return nil, errRoaringCorrupt
+				}
+				for x := start; x <= end; x++ {
+					set = append(set, high|x)
+				}
+			}
+		} else if cards[i] <= roaringMaxArray {
+			for j := 0; j < cards[i] && r.err == nil; j++ {
+				set = append(set, high|uint64(r.uint16()))
+			}
+		} else {
+			for j := 0; j < 1024 && r.err == nil; j++ {
+				word := r.uint64()
+				for word != 0 {
+					tz := bits.TrailingZeros64(word)
+					set = append(set, high|uint64(64*j+tz))
+					word &= word - 1
+				}
+			}
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+
+	return set, r.err
+}
+
+// Reads little-endian integers from a serialized Roaring bitmap.
+type roaringReader struct {
+	data []byte
+	err  error
+}
+
+// Returns the next n bytes, or nil if there are fewer left.
+func (r *roaringReader) bytes(n int) []byte {
+	if n > len(r.data) {
+		r.err = errRoaringCorrupt
+		r.data = nil
+		return nil
+	}
+	ret := r.data[:n]
+	r.data = r.data[n:]
+	return ret
+}
+
+func (r *roaringReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *roaringReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *roaringReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
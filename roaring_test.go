@@ -0,0 +1,83 @@
+package ncrlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func TestRoaring(t *testing.T) {
+	// Has array containers, and a bitmap container for the values
+	// from 1<<16 on.
+	set := sample(1<<16, 100)
+	for x := uint64(1 << 16); x < 1<<17; x += 3 {
+		set = append(set, x)
+	}
+	set = append(set, 1<<32-1)
+	slices.Sort(set)
+
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+	data, err := DecompressToRoaring(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := CompressRoaring(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	set2, err := Decompress(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(set, set2) {
+		t.Fatalf("%v %v", set, set2)
+	}
+
+	// Truncated
+	if err := CompressRoaring(buf, data[:len(data)-1]); err != errRoaringCorrupt {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	CompressSorted(buf, []uint64{1, 1 << 32})
+	if _, err := DecompressToRoaring(buf); err != errRoaringTooLarge {
+		t.Fatal(err)
+	}
+}
+
+func TestRoaringRunContainer(t *testing.T) {
+	// Two containers, of which the first is a run container with the
+	// values 1, …, 100, and the second an array container with 65541.
+	var data []byte
+	data = binary.LittleEndian.AppendUint32(data, roaringCookie|1<<16)
+	data = append(data, 0b01)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	data = binary.LittleEndian.AppendUint16(data, 99)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 99)
+	data = binary.LittleEndian.AppendUint16(data, 5)
+
+	buf := new(bytes.Buffer)
+	if err := CompressRoaring(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decompress(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []uint64
+	for x := uint64(1); x <= 100; x++ {
+		want = append(want, x)
+	}
+	want = append(want, 65541)
+	if !slices.Equal(got, want) {
+		t.Fatalf("%v %v", got, want)
+	}
+}
@@ -0,0 +1,276 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+)
+
+// Reads the values of a set one at a time.
+type valueReader struct {
+	d   *Decompressor
+	buf []uint64
+	xs  []uint64 // values in buf not yet returned
+}
+
+// Returns a new valueReader. Call Close when done with it.
+func newValueReader(r io.Reader) (*valueReader, error) {
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return nil, err
+	}
+	return &valueReader{d: d, buf: GetBuffer()}, nil
+}
+
+// Returns the buffer to the pool.
+func (vr *valueReader) Close() {
+	PutBuffer(vr.buf)
+	vr.buf = nil
+	vr.xs = nil
+}
+
+// Returns the next value without consuming it. Returns false if there
+// are no values left.
+func (vr *valueReader) Peek() (uint64, bool, error) {
+	if len(vr.xs) == 0 {
+		if vr.d.Remaining() == 0 {
+			return 0, false, nil
+		}
+
+		vr.xs = vr.buf[:min(len(vr.buf), int(vr.d.Remaining()))]
+		if err := vr.d.Read(vr.xs); err != nil {
+			return 0, false, err
+		}
+	}
+
+	return vr.xs[0], true, nil
+}
+
+// Consumes the value returned by Peek.
+func (vr *valueReader) Skip() {
+	vr.xs = vr.xs[1:]
+}
+
+// Merges the sets read from a and b, calling fn in order for each value
+// that's in either, with whether it's in a and whether it's in b.
+func merge(a, b io.Reader, fn func(x uint64, inA, inB bool)) error {
+	ra, err := newValueReader(a)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	rb, err := newValueReader(b)
+	if err != nil {
+		return err
+	}
+	defer rb.Close()
+
+	for {
+		x, okA, err := ra.Peek()
+		if err != nil {
+			return err
+		}
+		y, okB, err := rb.Peek()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !okA && !okB:
+			return nil
+		case okA && (!okB || x < y):
+			fn(x, true, false)
+			ra.Skip()
+		case okB && (!okA || y < x):
+			fn(y, false, true)
+			rb.Skip()
+		default:
+			fn(x, true, true)
+			ra.Skip()
+			rb.Skip()
+		}
+	}
+}
+
+// Writes to w the compressed set of values that are in exactly one of the
+// compressed sets read from a and b.
+func SymmetricDifference(w io.Writer, a, b io.Reader) error {
+	ret := []uint64{}
+	err := merge(a, b, func(x uint64, inA, inB bool) {
+		if inA != inB {
+			ret = append(ret, x)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return CompressSorted(w, ret)
+}
+
+// Writes to w the compressed set of values that are in either of the
+// compressed sets read from a and b.
+//
+// Adds the merged values to a Compressor, so neither set is held in
+// memory decompressed. The output is the same as that of CompressSorted.
+func Union(w io.Writer, a, b io.Reader) error {
+	c := NewCompressor(w)
+
+	// The merged values are increasing, so Add only fails if spilling
+	// does, and then Close returns that error as well.
+	err := merge(a, b, func(x uint64, inA, inB bool) {
+		c.Add(x)
+	})
+	if err != nil {
+		c.Close()
+		return err
+	}
+	return c.Close()
+}
+
+// Returns the Jaccard similarity of the compressed sets read from a and b:
+// the size of their intersection divided by the size of their union, or 1
+// if both are empty. Only counts, so it doesn't keep the values in memory.
+func Jaccard(a, b io.Reader) (float64, error) {
+	var intersection, union uint64
+	err := merge(a, b, func(x uint64, inA, inB bool) {
+		union++
+		if inA && inB {
+			intersection++
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if union == 0 {
+		return 1, nil
+	}
+	return float64(intersection) / float64(union), nil
+}
+
+// Decompresses the remaining values, and returns their union with extra,
+// which must be sorted, but may contain duplicates or values in the set.
+//
+// Merges while decoding, so the values are only written once.
+func (d *Decompressor) MergeWith(extra []uint64) ([]uint64, error) {
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+
+	for i := 1; i < len(extra); i++ {
+		if extra[i] < extra[i-1] {
+			return nil, errNotSorted
+		}
+	}
+
+	if d.remaining > MaxSetSize-uint64(len(extra)) {
+		return nil, ErrTooLarge
+	}
+
+	// Don't trust the size for the allocation; see readN.
+	ret := make([]uint64, 0, min(d.remaining, decompressChunk)+
+		uint64(len(extra)))
+	add := func(x uint64) {
+		if len(ret) == 0 || x != ret[len(ret)-1] {
+			ret = append(ret, x)
+		}
+	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+
+	j := 0
+	for d.remaining > 0 {
+		xs := buf[:min(uint64(len(buf)), d.remaining)]
+		if err := d.Read(xs); err != nil {
+			return nil, err
+		}
+
+		for _, x := range xs {
+			for ; j < len(extra) && extra[j] < x; j++ {
+				add(extra[j])
+			}
+			add(x)
+		}
+	}
+
+	for ; j < len(extra); j++ {
+		add(extra[j])
+	}
+
+	return ret, nil
+}
+
+// Builds a compressed set from sorted runs of values, which may overlap.
+type SetBuilder struct {
+	w      io.Writer
+	xs     []uint64 // sorted values without duplicates so far
+	closed bool
+}
+
+// Returns a SetBuilder that writes the compressed set to w on Close.
+func NewSetBuilder(w io.Writer) *SetBuilder {
+	return &SetBuilder{w: w}
+}
+
+var errNotSorted = errors.New("Values are not sorted")
+
+// Adds the values, which must be sorted, but may contain duplicates or
+// values that were added before.
+func (b *SetBuilder) AddSorted(values []uint64) error {
+	if b.closed {
+		return errBuilderClosed
+	}
+
+	for i := 1; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			return errNotSorted
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Common case: the values come after those we have already.
+	if len(b.xs) == 0 || values[0] > b.xs[len(b.xs)-1] {
+		for _, x := range values {
+			if len(b.xs) == 0 || x != b.xs[len(b.xs)-1] {
+				b.xs = append(b.xs, x)
+			}
+		}
+		return nil
+	}
+
+	merged := make([]uint64, 0, len(b.xs)+len(values))
+	i, j := 0, 0
+	for i < len(b.xs) || j < len(values) {
+		var x uint64
+		if j == len(values) || (i < len(b.xs) && b.xs[i] <= values[j]) {
+			x = b.xs[i]
+			i++
+		} else {
+			x = values[j]
+			j++
+		}
+
+		if len(merged) == 0 || x != merged[len(merged)-1] {
+			merged = append(merged, x)
+		}
+	}
+	b.xs = merged
+
+	return nil
+}
+
+var errBuilderClosed = errors.New("SetBuilder is closed")
+
+// Writes the compressed set of all values added.
+func (b *SetBuilder) Close() error {
+	if b.closed {
+		return errBuilderClosed
+	}
+	b.closed = true
+	err := CompressSorted(b.w, b.xs)
+	b.xs = nil
+	return err
+}
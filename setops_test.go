@@ -0,0 +1,228 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func compressed(set []uint64) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	Compress(buf, slices.Clone(set))
+	return buf
+}
+
+func TestSymmetricDifference(t *testing.T) {
+	for _, tc := range []struct {
+		a, b, want []uint64
+	}{
+		{[]uint64{1, 2, 3}, []uint64{1, 2, 3}, []uint64{}},
+		{[]uint64{1, 3, 5}, []uint64{2, 4, 6}, []uint64{1, 2, 3, 4, 5, 6}},
+		{[]uint64{}, []uint64{7}, []uint64{7}},
+		{[]uint64{1, 2, 3, 10}, []uint64{2, 3, 4}, []uint64{1, 4, 10}},
+	} {
+		buf := new(bytes.Buffer)
+		err := SymmetricDifference(buf, compressed(tc.a), compressed(tc.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decompress(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Fatalf("%v △ %v = %v ≠ %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	a := sample(100000, 5000)
+	b := sample(100000, 5000)
+	buf := new(bytes.Buffer)
+	err := SymmetricDifference(buf, compressed(a), compressed(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decompress(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := make(map[uint64]int)
+	for _, x := range append(a, b...) {
+		count[x]++
+	}
+	want := []uint64{}
+	for x, c := range count {
+		if c == 1 {
+			want = append(want, x)
+		}
+	}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatal("mismatch on random sets")
+	}
+}
+
+func TestUnion(t *testing.T) {
+	for i, tc := range [][2][]uint64{
+		{{}, {}},
+		{{}, {7}},
+		{{1, 2, 3}, {1, 2, 3}},
+		{{1, 3, 5}, {2, 4, 6}},
+		{{0, 1<<64 - 1}, {5}},
+		{sample(100000, 5000), sample(100000, 5000)},
+		{sample(1<<40, 5000), sample(100000, 50)},
+	} {
+		a, b := tc[0], tc[1]
+
+		buf := new(bytes.Buffer)
+		if err := Union(buf, compressed(a), compressed(b)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Compare with decompressing, merging and compressing.
+		want := append(slices.Clone(a), b...)
+		slices.Sort(want)
+		want = slices.Compact(want)
+		wantBuf := new(bytes.Buffer)
+		CompressSorted(wantBuf, want)
+
+		if !bytes.Equal(buf.Bytes(), wantBuf.Bytes()) {
+			t.Fatalf("%d: %d ≠ %d bytes", i, buf.Len(), wantBuf.Len())
+		}
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	buf := GetBuffer()
+	if len(buf) != BufferSize {
+		t.Fatal(len(buf))
+	}
+	PutBuffer(buf[:10])
+
+	buf = GetBuffer()
+	if len(buf) != BufferSize {
+		t.Fatal(len(buf))
+	}
+	PutBuffer(buf)
+
+	// Too small buffers are dropped.
+	PutBuffer(make([]uint64, 10))
+	if len(GetBuffer()) != BufferSize {
+		t.Fatal()
+	}
+
+	// Reusing a buffer doesn't allocate.
+	allocs := testing.AllocsPerRun(100, func() {
+		PutBuffer(GetBuffer())
+	})
+	if allocs != 0 {
+		t.Fatal(allocs)
+	}
+}
+
+func TestSetBuilder(t *testing.T) {
+	buf := new(bytes.Buffer)
+	b := NewSetBuilder(buf)
+
+	for _, run := range [][]uint64{
+		{1, 2, 2, 3},
+		{},
+		{5, 8},
+		{0, 2, 4, 8, 9},
+		{10, 11},
+		{11, 11, 12},
+	} {
+		if err := b.AddSorted(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.AddSorted([]uint64{3, 2}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decompress(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint64{0, 1, 2, 3, 4, 5, 8, 9, 10, 11, 12}
+	if !slices.Equal(got, want) {
+		t.Fatalf("%v ≠ %v", got, want)
+	}
+
+	if err := b.AddSorted([]uint64{13}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestMergeWith(t *testing.T) {
+	for _, tc := range []struct {
+		set, extra, want []uint64
+	}{
+		{[]uint64{}, []uint64{}, []uint64{}},
+		{[]uint64{1, 2, 3}, []uint64{}, []uint64{1, 2, 3}},
+		{[]uint64{}, []uint64{4, 4, 5}, []uint64{4, 5}},
+		{[]uint64{1, 3, 5}, []uint64{0, 3, 3, 6}, []uint64{0, 1, 3, 5, 6}},
+	} {
+		d, err := NewDecompressor(compressed(tc.set))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.MergeWith(tc.extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Fatalf("%v ∪ %v = %v ≠ %v", tc.set, tc.extra, got, tc.want)
+		}
+	}
+
+	set := sample(100000, 5000)
+	extra := sample(100000, 1000)
+	slices.Sort(extra)
+	d, err := NewDecompressor(compressed(set))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.MergeWith(extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(slices.Clone(set), extra...)
+	slices.Sort(want)
+	want = slices.Compact(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("%v %v", got, want)
+	}
+
+	d, _ = NewDecompressor(compressed(set))
+	if _, err := d.MergeWith([]uint64{2, 1}); err != errNotSorted {
+		t.Fatal(err)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	for _, tc := range []struct {
+		a, b []uint64
+		want float64
+	}{
+		{[]uint64{}, []uint64{}, 1},
+		{[]uint64{1, 2, 3}, []uint64{1, 2, 3}, 1},
+		{[]uint64{1, 3, 5}, []uint64{2, 4, 6}, 0},
+		{[]uint64{}, []uint64{7}, 0},
+		{[]uint64{1, 2, 3, 10}, []uint64{2, 3, 4}, 0.4},
+	} {
+		got, err := Jaccard(compressed(tc.a), compressed(tc.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Fatalf("J(%v, %v) = %v ≠ %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
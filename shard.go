@@ -0,0 +1,108 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Decompresses the set from r and splits it into len(ws) shards, which are
+// compressed independently to the respective writers in ws.
+//
+// The shards are disjoint ranges: the first shard gets the smallest
+// values, and so on. They're of equal size, up to one value. The set is
+// decoded only once, and only one shard is held in memory at a time.
+func ShardTo(ws []io.Writer, r io.Reader) error {
+	if len(ws) == 0 {
+		return errors.New("No shards")
+	}
+
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return err
+	}
+
+	size := d.Remaining()
+	n := uint64(len(ws))
+	start := uint64(0)
+
+	for i, w := range ws {
+		// End of this shard: ⌊size (i+1) / n⌋, which might not fit in a
+		// uint64 before dividing.
+		hi, lo := bits.Mul64(size, uint64(i+1))
+		end, _ := bits.Div64(hi, lo, n)
+
+		shard, err := d.readN(end - start)
+		if err != nil {
+			return err
+		}
+
+		if err := CompressSorted(w, shard); err != nil {
+			return err
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+// Decompresses the remaining values and calls fn with those of each shard
+// in turn, where boundaries, which must be sorted, splits the values into
+// len(boundaries)+1 shards: shard i has the values from boundaries[i-1]
+// up to, but not including, boundaries[i].
+//
+// fn is called for every shard, also for empty ones. values is reused for
+// the next shard, so it's only valid during the call. Only one shard is
+// held in memory at a time. Stops at the first error returned by fn.
+func (d *Decompressor) ReadByRange(boundaries []uint64,
+	fn func(shard int, values []uint64) error) error {
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i] < boundaries[i-1] {
+			return errNotSorted
+		}
+	}
+
+	// Remaining hides the error of a lazy header.
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+
+	var values []uint64
+	for shard := 0; shard <= len(boundaries); shard++ {
+		last := shard == len(boundaries)
+		values = values[:0]
+
+		for d.Remaining() > 0 && (last || boundaries[shard] > 0) {
+			var n int
+			if last {
+				n = int(min(uint64(len(buf)), d.Remaining()))
+				if err := d.Read(buf[:n]); err != nil {
+					return err
+				}
+			} else {
+				var err error
+				n, err = d.ReadUntil(boundaries[shard]-1, buf)
+				if err != nil {
+					return err
+				}
+			}
+
+			values = append(values, buf[:n]...)
+
+			// ReadUntil stopped at the boundary.
+			if !last && n < len(buf) {
+				break
+			}
+		}
+
+		if err := fn(shard, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package ncrlite
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestShardTo(t *testing.T) {
+	for _, k := range []int{0, 1, 5, 1000} {
+		set := sample(100000, k)
+		slices.Sort(set)
+
+		var buf bytes.Buffer
+		CompressSorted(&buf, set)
+
+		for _, n := range []int{1, 3, 7} {
+			bufs := make([]bytes.Buffer, n)
+			ws := make([]io.Writer, n)
+			for i := range ws {
+				ws[i] = &bufs[i]
+			}
+
+			if err := ShardTo(ws, bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+
+			ret := []uint64{}
+			for i := range bufs {
+				shard, err := Decompress(&bufs[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(shard) < k/n || len(shard) > k/n+1 {
+					t.Fatalf("%d %d %d", len(shard), k, n)
+				}
+				ret = append(ret, shard...)
+			}
+
+			if !slices.Equal(set, ret) {
+				t.Fatalf("%v %v", set, ret)
+			}
+		}
+	}
+}
+
+func TestReadByRange(t *testing.T) {
+	set := sample(100000, 5000)
+	slices.Sort(set)
+
+	for _, boundaries := range [][]uint64{
+		{},
+		{0},
+		{50000},
+		{0, 10, 10, 20000, 60000, 100000, 1 << 40},
+	} {
+		d, err := NewDecompressor(compressed(set))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		next := 0
+		err = d.ReadByRange(boundaries, func(shard int, values []uint64) error {
+			if shard != next {
+				t.Fatalf("%d %d", shard, next)
+			}
+			next++
+
+			var want []uint64
+			for _, x := range set {
+				if (shard == 0 || x >= boundaries[shard-1]) &&
+					(shard == len(boundaries) || x < boundaries[shard]) {
+					want = append(want, x)
+				}
+			}
+			if !slices.Equal(values, want) {
+				t.Fatalf("%v %d: %v %v", boundaries, shard, values, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != len(boundaries)+1 {
+			t.Fatalf("%d shards", next)
+		}
+	}
+}
+
+func TestReadByRangeCorruptHeader(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{2, 0, 0xff, 0xff}, // unsupported format flags
+	} {
+		d := NewLazyDecompressor(bytes.NewReader(data))
+		err := d.ReadByRange([]uint64{10}, func(int, []uint64) error {
+			t.Fatal("fn called")
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("%v: expected error", data)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ncrlite
+
+// Receives decompressed values from ReadTo.
+type ValueSink interface {
+	// Called with each value in turn.
+	Append(v uint64)
+}
+
+// ValueSink that appends the values to Values.
+type SliceSink struct {
+	Values []uint64
+}
+
+func (s *SliceSink) Append(v uint64) {
+	s.Values = append(s.Values, v)
+}
+
+// ValueSink that sets the bit at position v-Base in Bitmap for each value
+// v, like ReadBitmap. Values outside of Bitmap are skipped, and make Err
+// return an error; ReadTo returns it right away.
+type BitmapSink struct {
+	Bitmap []uint64
+	Base   uint64
+
+	err error
+}
+
+func (s *BitmapSink) Append(v uint64) {
+	if err := setBits(s.Bitmap, s.Base, []uint64{v}); err != nil {
+		s.err = err
+	}
+}
+
+// Returns an error if a value passed to Append was outside of Bitmap.
+func (s *BitmapSink) Err() error {
+	return s.err
+}
+
+// ValueSink that counts the values.
+type CountSink struct {
+	Count uint64
+}
+
+func (s *CountSink) Append(v uint64) {
+	s.Count++
+}
+
+// Decompresses the remaining values, and passes them to sink in order.
+//
+// The SliceSink, BitmapSink and CountSink of this package are filled a
+// batch at a time, without calling Append for every value. For a
+// BitmapSink, returns an error at the first value outside of its Bitmap.
+func (d *Decompressor) ReadTo(sink ValueSink) error {
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+
+	for d.remaining > 0 {
+		xs := buf[:min(uint64(len(buf)), d.remaining)]
+		if err := d.Read(xs); err != nil {
+			return err
+		}
+
+		switch sink := sink.(type) {
+		case *SliceSink:
+			sink.Values = append(sink.Values, xs...)
+		case *BitmapSink:
+			if err := setBits(sink.Bitmap, sink.Base, xs); err != nil {
+				sink.err = err
+				return err
+			}
+		case *CountSink:
+			sink.Count += uint64(len(xs))
+		default:
+			for _, x := range xs {
+				sink.Append(x)
+			}
+		}
+	}
+
+	return nil
+}
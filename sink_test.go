@@ -0,0 +1,93 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// ValueSink that sums the values.
+type sumSink struct {
+	sum uint64
+}
+
+func (s *sumSink) Append(v uint64) {
+	s.sum += v
+}
+
+func TestReadTo(t *testing.T) {
+	set := sample(100000, 5000)
+	slices.Sort(set)
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, set)
+	xs := buf.Bytes()
+
+	readTo := func(sink ValueSink) {
+		d, err := NewDecompressor(bytes.NewReader(xs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.ReadTo(sink); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var slice SliceSink
+	readTo(&slice)
+	if !slices.Equal(slice.Values, set) {
+		t.Fatalf("%v %v", slice.Values, set)
+	}
+
+	var count CountSink
+	readTo(&count)
+	if count.Count != uint64(len(set)) {
+		t.Fatal(count.Count)
+	}
+
+	bitmap := BitmapSink{Bitmap: make([]uint64, 100000/64+1)}
+	readTo(&bitmap)
+	bm := make([]uint64, len(bitmap.Bitmap))
+	d, _ := NewDecompressor(bytes.NewReader(xs))
+	d.ReadBitmap(bm, 0)
+	if !slices.Equal(bitmap.Bitmap, bm) {
+		t.Fatal("bitmaps differ")
+	}
+
+	var sum sumSink
+	readTo(&sum)
+	want := uint64(0)
+	for _, x := range set {
+		want += x
+	}
+	if sum.sum != want {
+		t.Fatalf("%d %d", sum.sum, want)
+	}
+}
+
+func TestBitmapSinkBounds(t *testing.T) {
+	buf := new(bytes.Buffer)
+	CompressSorted(buf, []uint64{10, 20, 200})
+	xs := buf.Bytes()
+
+	for _, base := range []uint64{0, 15} {
+		bitmap := BitmapSink{Bitmap: make([]uint64, 2), Base: base}
+		d, err := NewDecompressor(bytes.NewReader(xs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.ReadTo(&bitmap); err != errBitmapBounds {
+			t.Fatal(err)
+		}
+		if bitmap.Err() != errBitmapBounds {
+			t.Fatal(bitmap.Err())
+		}
+	}
+
+	bitmap := BitmapSink{Bitmap: make([]uint64, 1), Base: 10}
+	bitmap.Append(10)
+	bitmap.Append(5)
+	bitmap.Append(100)
+	if bitmap.Err() != errBitmapBounds || bitmap.Bitmap[0] != 1 {
+		t.Fatalf("%v %b", bitmap.Err(), bitmap.Bitmap[0])
+	}
+}
@@ -0,0 +1,27 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+)
+
+var errStringsNotSorted = errors.New("Strings have duplicates or are not sorted")
+
+// Writes the ranks 0, …, len(sorted)-1 of the strings in sorted to w as
+// a compressed set, after checking that sorted is strictly increasing.
+//
+// As the ranks form an arithmetic progression, this takes only a few
+// bytes beyond the size. The ranks serve as term ids: use them as keys
+// with CompressColumns to store a value, such as a posting list offset,
+// for each term.
+func CompressStrings(w io.Writer, sorted []string) error {
+	ranks := make([]uint64, len(sorted))
+	for i := range sorted {
+		if i > 0 && sorted[i] <= sorted[i-1] {
+			return errStringsNotSorted
+		}
+		ranks[i] = uint64(i)
+	}
+
+	return CompressSorted(w, ranks)
+}
@@ -0,0 +1,43 @@
+package ncrlite
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCompressStrings(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 1000, 1000000} {
+		terms := make([]string, n)
+		for i := range terms {
+			terms[i] = fmt.Sprintf("term%08d", i)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := CompressStrings(buf, terms); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() > int(uvarintLen(uint64(n)))+3 {
+			t.Fatalf("%d: %d bytes", n, buf.Len())
+		}
+
+		ranks, err := Decompress(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ranks) != n {
+			t.Fatalf("%d %d", len(ranks), n)
+		}
+		for i, r := range ranks {
+			if r != uint64(i) {
+				t.Fatalf("%d: %d", i, r)
+			}
+		}
+	}
+
+	for _, terms := range [][]string{{"b", "a"}, {"a", "b", "b"}} {
+		if err := CompressStrings(new(bytes.Buffer), terms); err == nil {
+			t.Fatalf("%v: expected error", terms)
+		}
+	}
+}
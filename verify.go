@@ -0,0 +1,66 @@
+package ncrlite
+
+import (
+	"errors"
+	"io"
+)
+
+var errVerify = errors.New("Compressed set doesn't decompress to the input")
+
+// Writes a compressed version of set to w, as CompressSorted, while
+// decompressing what's written on the fly. Returns an error if that
+// doesn't give set back.
+//
+// The compressed bytes are passed on to w as they're checked, so on error,
+// w may have received part or all of them.
+func CompressVerified(w io.Writer, set []uint64) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		err := verify(pr, set)
+		if err == nil {
+			// Let the compressor finish.
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	err := CompressSorted(io.MultiWriter(w, pw), set)
+	pw.CloseWithError(err)
+	verr := <-done
+
+	if err != nil {
+		return err
+	}
+	return verr
+}
+
+// Decompresses a set from r and checks that it's set. Requires the
+// endmarker, so that a truncated stream doesn't pass.
+func verify(r io.Reader, set []uint64) error {
+	d, err := NewDecompressor(r)
+	if err != nil {
+		return err
+	}
+	if d.Remaining() != uint64(len(set)) {
+		return errVerify
+	}
+
+	var buf [512]uint64
+	for len(set) > 0 {
+		xs := buf[:min(len(buf), len(set))]
+		if err := d.Read(xs); err != nil {
+			return err
+		}
+		for i, x := range xs {
+			if x != set[i] {
+				return errVerify
+			}
+		}
+		set = set[len(xs):]
+	}
+
+	return nil
+}
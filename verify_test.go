@@ -0,0 +1,48 @@
+package ncrlite
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestCompressVerified(t *testing.T) {
+	for _, set := range [][]uint64{
+		{},
+		{5},
+		{1, 2, 3},
+		sample(1000000, 100000),
+	} {
+		slices.Sort(set)
+
+		var buf, want bytes.Buffer
+		if err := CompressVerified(&buf, set); err != nil {
+			t.Fatal(err)
+		}
+		CompressSorted(&want, set)
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Fatalf("%v: output differs", set)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := CompressVerified(&buf, []uint64{3, 1}); err != errNotSet {
+		t.Fatal(err)
+	}
+
+	// A mismatch, as if the encoder had a bug.
+	buf.Reset()
+	CompressSorted(&buf, []uint64{1, 2, 3})
+	if err := verify(&buf, []uint64{1, 2, 4}); err != errVerify {
+		t.Fatal(err)
+	}
+
+	// Without the endmarker at the end.
+	for _, set := range [][]uint64{{1, 2, 3}, {0, 1, 2, 3, 4, 5, 6, 7, 1007}} {
+		buf.Reset()
+		CompressSortedWithOptions(&buf, set, &CompressOptions{OmitEndMarker: true})
+		if err := verify(&buf, set); err == nil {
+			t.Fatalf("%v: missing endmarker not detected", set)
+		}
+	}
+}